@@ -0,0 +1,109 @@
+package vsock
+
+import (
+	"os"
+	"sync"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd when using
+// socket activation, as defined by sd_listen_fds(3).
+const listenFDsStart = 3
+
+// An activationFile is a VM socket passed to this process by systemd.
+type activationFile struct {
+	name     string
+	f        *os.File
+	listener bool
+}
+
+var (
+	activationOnce  sync.Once
+	activationFiles []activationFile
+	activationErr   error
+)
+
+// activation fetches the VM sockets passed to this process by systemd. The
+// environment can only be consumed once, so the result is cached for the
+// lifetime of the process.
+func activation() ([]activationFile, error) {
+	activationOnce.Do(func() {
+		activationFiles, activationErr = listenFDs(listenFDsStart)
+	})
+
+	return activationFiles, activationErr
+}
+
+// ActivationListeners returns the VM sockets listeners passed to this process
+// by systemd socket activation, such as with ListenStream=vsock::1024,
+// keyed by the names set with FileDescriptorName= (or "unknown" if unnamed).
+//
+// As with sd_listen_fds(3), the LISTEN_PID, LISTEN_FDS, and LISTEN_FDNAMES
+// environment variables are unset on the first call to ActivationListeners or
+// ActivationConns. File descriptors which are not VM sockets are skipped and
+// left open, and if any are present the environment is kept intact so that
+// other code can find them. Such code will also see the file descriptors of
+// the VM sockets and must skip them. Each call returns new copies of the
+// passed sockets and it is the caller's responsibility to close them.
+//
+// If the process was not socket activated, an empty map and a nil error are
+// returned.
+func ActivationListeners() (map[string][]*Listener, error) {
+	files, err := activation()
+	if err != nil {
+		return nil, err
+	}
+
+	ls := make(map[string][]*Listener)
+	for _, af := range files {
+		if !af.listener {
+			continue
+		}
+
+		l, err := FileListener(af.f)
+		if err != nil {
+			for _, lls := range ls {
+				for _, l := range lls {
+					_ = l.Close()
+				}
+			}
+			return nil, err
+		}
+
+		ls[af.name] = append(ls[af.name], l)
+	}
+
+	return ls, nil
+}
+
+// ActivationConns returns the VM sockets connections passed to this process by
+// systemd socket activation with Accept=yes, keyed by the names set with
+// FileDescriptorName= (or "unknown" if unnamed).
+//
+// See ActivationListeners for details on how the environment is consumed.
+func ActivationConns() (map[string][]*Conn, error) {
+	files, err := activation()
+	if err != nil {
+		return nil, err
+	}
+
+	cs := make(map[string][]*Conn)
+	for _, af := range files {
+		if af.listener {
+			continue
+		}
+
+		c, err := FileConn(af.f)
+		if err != nil {
+			for _, ccs := range cs {
+				for _, c := range ccs {
+					_ = c.Close()
+				}
+			}
+			return nil, err
+		}
+
+		cs[af.name] = append(cs[af.name], c)
+	}
+
+	return cs, nil
+}
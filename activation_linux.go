@@ -0,0 +1,86 @@
+//go:build linux
+
+package vsock
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenFDs is the entry point for socket activation on Linux. It parses the
+// systemd environment variables and returns the VM sockets beginning at file
+// descriptor start.
+func listenFDs(start int) ([]activationFile, error) {
+	// Like sd_listen_fds(3), unset the environment so child processes don't
+	// attempt to use the same file descriptors. If any file descriptors are
+	// not VM sockets, keep the environment so other code can find them.
+	var keep bool
+	defer func() {
+		if keep {
+			return
+		}
+
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	spid := os.Getenv("LISTEN_PID")
+	if spid == "" {
+		// Not socket activated.
+		return nil, nil
+	}
+
+	pid, err := strconv.Atoi(spid)
+	if err != nil {
+		return nil, fmt.Errorf("vsock: invalid LISTEN_PID %q: %v", spid, err)
+	}
+	if pid != os.Getpid() {
+		// The file descriptors were meant for another process.
+		return nil, nil
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds < 0 {
+		return nil, fmt.Errorf("vsock: invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	var files []activationFile
+	for i := 0; i < nfds; i++ {
+		fd := start + i
+
+		// Skip anything which is not a VM socket, including file descriptors
+		// which are not sockets at all. These are left untouched for use by
+		// other code.
+		domain, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_DOMAIN)
+		if err != nil || domain != unix.AF_VSOCK {
+			keep = true
+			continue
+		}
+
+		acc, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ACCEPTCONN)
+		if err != nil {
+			return nil, os.NewSyscallError("getsockopt", err)
+		}
+
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		unix.CloseOnExec(fd)
+		files = append(files, activationFile{
+			name:     name,
+			f:        os.NewFile(uintptr(fd), name),
+			listener: acc == 1,
+		})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,140 @@
+package vsock
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+func Test_listenFDs(t *testing.T) {
+	// Pick a high file descriptor number so the test can simulate systemd
+	// passing file descriptors without clobbering any in use by the runtime.
+	const start = 200
+
+	// Binding to the wildcard CID doesn't require loopback support.
+	vfd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Skipf("skipping, failed to open vsock: %v", err)
+	}
+	defer unix.Close(vfd)
+
+	if err := unix.Bind(vfd, &unix.SockaddrVM{
+		CID:  unix.VMADDR_CID_ANY,
+		Port: unix.VMADDR_PORT_ANY,
+	}); err != nil {
+		t.Skipf("skipping, failed to bind vsock: %v", err)
+	}
+	if err := unix.Listen(vfd, unix.SOMAXCONN); err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ufds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("failed to open socket pair: %v", err)
+	}
+	defer unix.Close(ufds[0])
+	defer unix.Close(ufds[1])
+
+	// Pass a UNIX socket first and a vsock listener second, as systemd would
+	// for a mix of ListenStream= directives.
+	for i, fd := range []int{ufds[0], vfd} {
+		if err := unix.Dup3(fd, start+i, unix.O_CLOEXEC); err != nil {
+			t.Fatalf("failed to dup: %v", err)
+		}
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "unix:vsock")
+
+	files, err := listenFDs(start)
+	if err != nil {
+		t.Fatalf("failed to get listen fds: %v", err)
+	}
+	defer unix.Close(start)
+
+	if len(files) != 1 {
+		t.Fatalf("expected 1 vsock file, but got: %d", len(files))
+	}
+	defer files[0].f.Close()
+
+	if diff := cmp.Diff("vsock", files[0].name); diff != "" {
+		t.Fatalf("unexpected name (-want +got):\n%s", diff)
+	}
+	if !files[0].listener {
+		t.Fatal("expected vsock file to be a listener")
+	}
+
+	l, err := FileListener(files[0].f)
+	if err != nil {
+		t.Fatalf("failed to open file listener: %v", err)
+	}
+	defer l.Close()
+
+	// The UNIX socket must be left open, and the environment kept, so that
+	// other code can find it.
+	if _, err := unix.GetsockoptInt(start, unix.SOL_SOCKET, unix.SO_DOMAIN); err != nil {
+		t.Fatalf("expected UNIX socket to remain open: %v", err)
+	}
+	for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if _, ok := os.LookupEnv(env); !ok {
+			t.Fatalf("expected %s to be kept, but it was unset", env)
+		}
+	}
+
+	// When only VM sockets are passed, the environment is consumed.
+	if err := unix.Dup3(vfd, start+2, unix.O_CLOEXEC); err != nil {
+		t.Fatalf("failed to dup: %v", err)
+	}
+
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "vsock")
+
+	files, err = listenFDs(start + 2)
+	if err != nil {
+		t.Fatalf("failed to get listen fds: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 vsock file, but got: %d", len(files))
+	}
+	_ = files[0].f.Close()
+
+	for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if v, ok := os.LookupEnv(env); ok {
+			t.Fatalf("expected %s to be unset, but got: %q", env, v)
+		}
+	}
+}
+
+func Test_listenFDsNotActivated(t *testing.T) {
+	tests := []struct {
+		name string
+		pid  string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "other process",
+			pid:  strconv.Itoa(os.Getpid() + 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", "1")
+
+			files, err := listenFDs(listenFDsStart)
+			if err != nil {
+				t.Fatalf("failed to get listen fds: %v", err)
+			}
+			if len(files) != 0 {
+				t.Fatalf("expected no files, but got: %d", len(files))
+			}
+		})
+	}
+}
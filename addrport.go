@@ -0,0 +1,96 @@
+package vsock
+
+import "cmp"
+
+// An AddrPort is the address of a VM sockets endpoint, consisting of a context
+// ID, port, and flags. Unlike *Addr, an AddrPort is an immutable value type
+// which is comparable and may be used as a map key.
+//
+// The zero value of AddrPort is the address of port 0 on the Hypervisor.
+//
+// On Linux, AddrPortFromSockaddr and AddrPort.Sockaddr convert to and from
+// unix.SockaddrVM, which only exists on Linux. Portable code can use
+// AddrPortFrom and AddrPort.WithFlags instead.
+type AddrPort struct {
+	cid, port uint32
+	flags     uint8
+}
+
+// AddrPortFrom returns an AddrPort with the provided context ID and port, and
+// no flags. Use WithFlags to set address flags.
+func AddrPortFrom(contextID, port uint32) AddrPort {
+	return AddrPort{
+		cid:  contextID,
+		port: port,
+	}
+}
+
+// WithFlags returns an AddrPort which is the same as ap, but with the provided
+// address flags, such as FlagToHost.
+func (ap AddrPort) WithFlags(flags uint8) AddrPort {
+	ap.flags = flags
+	return ap
+}
+
+// CID returns the context ID of ap.
+func (ap AddrPort) CID() uint32 { return ap.cid }
+
+// Port returns the port of ap.
+func (ap AddrPort) Port() uint32 { return ap.port }
+
+// Flags returns the address flags of ap, such as FlagToHost.
+func (ap AddrPort) Flags() uint8 { return ap.flags }
+
+// IsHypervisor reports whether ap refers to the Hypervisor context ID.
+func (ap AddrPort) IsHypervisor() bool { return ap.cid == Hypervisor }
+
+// IsLocal reports whether ap refers to the Local context ID.
+func (ap AddrPort) IsLocal() bool { return ap.cid == Local }
+
+// IsHost reports whether ap refers to the Host context ID.
+func (ap AddrPort) IsHost() bool { return ap.cid == Host }
+
+// IsVM reports whether ap refers to the context ID of a virtual machine, rather
+// than one of the well-known or wildcard context IDs.
+func (ap AddrPort) IsVM() bool { return ap.cid > Host && ap.cid != cidAny }
+
+// Compare returns an integer comparing two AddrPorts by context ID, then by
+// port, then by flags. The result will be 0 if ap == ap2, -1 if ap < ap2, and
+// +1 if ap > ap2.
+func (ap AddrPort) Compare(ap2 AddrPort) int {
+	if c := cmp.Compare(ap.cid, ap2.cid); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(ap.port, ap2.port); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(ap.flags, ap2.flags)
+}
+
+// Addr returns a newly allocated *Addr with the same values as ap.
+func (ap AddrPort) Addr() *Addr {
+	return &Addr{
+		ContextID: ap.cid,
+		Port:      ap.port,
+		Flags:     ap.flags,
+	}
+}
+
+// String returns a human-readable representation of ap in the same form as
+// Addr.String.
+func (ap AddrPort) String() string { return ap.Addr().String() }
+
+// AddrPort returns the AddrPort equivalent of a. A nil *Addr produces the zero
+// value of AddrPort.
+func (a *Addr) AddrPort() AddrPort {
+	if a == nil {
+		return AddrPort{}
+	}
+
+	return AddrPort{
+		cid:   a.ContextID,
+		port:  a.Port,
+		flags: a.Flags,
+	}
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package vsock
+
+import "golang.org/x/sys/unix"
+
+// AddrPortFromSockaddr returns the AddrPort equivalent of sa, including its
+// flags. It is only available on Linux; see AddrPort for alternatives.
+func AddrPortFromSockaddr(sa *unix.SockaddrVM) AddrPort {
+	return AddrPort{
+		cid:   sa.CID,
+		port:  sa.Port,
+		flags: sa.Flags,
+	}
+}
+
+// Sockaddr returns a newly allocated *unix.SockaddrVM with the same values as
+// ap.
+func (ap AddrPort) Sockaddr() *unix.SockaddrVM {
+	return &unix.SockaddrVM{
+		CID:   ap.cid,
+		Port:  ap.port,
+		Flags: ap.flags,
+	}
+}
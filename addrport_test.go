@@ -0,0 +1,101 @@
+package vsock
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddrPortPredicates(t *testing.T) {
+	tests := []struct {
+		name                        string
+		ap                          AddrPort
+		hypervisor, local, host, vm bool
+	}{
+		{
+			name:       "hypervisor",
+			ap:         AddrPortFrom(Hypervisor, 1024),
+			hypervisor: true,
+		},
+		{
+			name:  "local",
+			ap:    AddrPortFrom(Local, 1024),
+			local: true,
+		},
+		{
+			name: "host",
+			ap:   AddrPortFrom(Host, 1024),
+			host: true,
+		},
+		{
+			name: "VM",
+			ap:   AddrPortFrom(3, 1024),
+			vm:   true,
+		},
+		{
+			name: "any",
+			ap:   AddrPortFrom(cidAny, 1024),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := []bool{tt.hypervisor, tt.local, tt.host, tt.vm}
+			got := []bool{tt.ap.IsHypervisor(), tt.ap.IsLocal(), tt.ap.IsHost(), tt.ap.IsVM()}
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("unexpected predicates (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddrPortCompare(t *testing.T) {
+	want := []AddrPort{
+		AddrPortFrom(Host, 1),
+		AddrPortFrom(Host, 2),
+		AddrPortFrom(Host, 2).WithFlags(FlagToHost),
+		AddrPortFrom(3, 1),
+		AddrPortFrom(4, 0),
+	}
+
+	got := slices.Clone(want)
+	slices.Reverse(got)
+	slices.SortFunc(got, AddrPort.Compare)
+
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(x, y AddrPort) bool { return x == y })); diff != "" {
+		t.Fatalf("unexpected sorted addresses (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddrPortAddr(t *testing.T) {
+	addr := &Addr{ContextID: 4, Port: 1024, Flags: FlagToHost}
+
+	ap := addr.AddrPort()
+	if ap.CID() != 4 || ap.Port() != 1024 || ap.Flags() != FlagToHost {
+		t.Fatalf("unexpected AddrPort values: %s", ap)
+	}
+	if ap != AddrPortFrom(4, 1024).WithFlags(FlagToHost) {
+		t.Fatalf("unexpected AddrPort with flags: %s", ap)
+	}
+
+	if diff := cmp.Diff(addr, ap.Addr()); diff != "" {
+		t.Fatalf("unexpected Addr (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(addr.String(), ap.String()); diff != "" {
+		t.Fatalf("unexpected string (-want +got):\n%s", diff)
+	}
+
+	// Equal addresses must produce equal map keys.
+	m := map[AddrPort]int{ap: 1}
+	if _, ok := m[(&Addr{ContextID: 4, Port: 1024, Flags: FlagToHost}).AddrPort()]; !ok {
+		t.Fatal("expected equal AddrPort map key")
+	}
+
+	var nilAddr *Addr
+	if ap := nilAddr.AddrPort(); ap != (AddrPort{}) {
+		t.Fatalf("expected zero AddrPort for nil *Addr, but got: %s", ap)
+	}
+}
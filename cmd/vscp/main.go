@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"flag"
 	"hash"
@@ -23,13 +24,17 @@ func main() {
 		flagReceive = flag.Bool("r", false, "receive files from another instance of vscp")
 		flagSend    = flag.Bool("s", false, "send files to another instance of vscp")
 
-		flagContextID = flag.Uint("c", 0, "send only: context ID of the remote VM socket")
-		flagPort      = flag.Uint("p", 0, "- receive: port ID to listen on (random port by default)\n\t- send: port ID to connect to")
+		flagContextID = flag.Uint("c", 0, `send only: context ID of the remote VM socket (deprecated: use "-a")`)
+		flagPort      = flag.Uint("p", 0, "- receive: port ID to listen on (random port by default)\n\t- send: port ID to connect to (deprecated: use \"-a\")")
 
 		flagHash    = flag.Bool("h", false, "display a checksum hash of the input or output data after transfer completes")
 		flagTimeout = flag.Duration("t", 0, "receive only: timeout for read operations (default: no timeout)")
+
+		flagAddr vsock.Addr
 	)
 
+	flag.Var(&flagAddr, "a", `send only: address of the remote VM socket, such as "host:1024" or "3:1024"`)
+
 	flag.Parse()
 	log.SetOutput(os.Stderr)
 
@@ -46,10 +51,26 @@ func main() {
 		if *flagContextID != 0 {
 			log.Fatalf(`vscp: context ID flag "-c" not valid for receive operation`)
 		}
+		if flagAddr != (vsock.Addr{}) {
+			log.Fatalf(`vscp: address flag "-a" not valid for receive operation`)
+		}
 
 		receive(target, uint32(*flagPort), *flagTimeout, *flagHash)
 	case *flagSend:
-		send(target, uint32(*flagContextID), uint32(*flagPort), *flagHash)
+		// The "-c" and "-p" flags are still accepted for compatibility, and
+		// build the address if "-a" is not specified.
+		addr := flagAddr
+		switch {
+		case addr == (vsock.Addr{}):
+			addr = vsock.Addr{
+				ContextID: uint32(*flagContextID),
+				Port:      uint32(*flagPort),
+			}
+		case *flagContextID != 0 || *flagPort != 0:
+			log.Fatalf(`vscp: specify only one of "-a" or "-c" and "-p" for send operation`)
+		}
+
+		send(target, &addr, *flagHash)
 	default:
 		flag.PrintDefaults()
 	}
@@ -136,7 +157,7 @@ func receive(target string, port uint32, timeout time.Duration, checksum bool) {
 // send dials a server and sends data to it using VM sockets.  The data
 // is read from target, which may be a file, or stdin if no file or "-"
 // is specified.
-func send(target string, cid, port uint32, checksum bool) {
+func send(target string, addr *vsock.Addr, checksum bool) {
 	// Log helper functions.
 	logf := func(format string, a ...any) {
 		logf("send: "+format, a...)
@@ -169,10 +190,11 @@ func send(target string, cid, port uint32, checksum bool) {
 		r = io.TeeReader(r, h)
 	}
 
-	logf("dialing: %d.%d", cid, port)
+	logf("dialing: %s", addr)
 
 	// Dial a remote server and send a stream to that server.
-	c, err := vsock.Dial(cid, port, nil)
+	var d vsock.Dialer
+	c, err := d.DialAddr(context.Background(), addr)
 	if err != nil {
 		fatalf("failed to dial: %v", err)
 	}
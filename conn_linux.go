@@ -4,6 +4,12 @@ package vsock
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
 
 	"github.com/mdlayher/socket"
 	"golang.org/x/sys/unix"
@@ -15,17 +21,60 @@ import (
 type conn = socket.Conn
 
 // dial is the entry point for Dial on Linux.
-func dial(cid, port uint32, _ *Config) (*Conn, error) {
-	// TODO(mdlayher): Config default nil check and initialize. Pass options to
-	// socket.Config where necessary.
+func dial(ctx context.Context, raddr *Addr, d *Dialer) (*Conn, error) {
+	cfg := d.Config
+	if cfg == nil {
+		cfg = &Config{}
+	}
 
-	c, err := socket.Socket(unix.AF_VSOCK, unix.SOCK_STREAM, 0, "vsock", nil)
+	c, err := newSocket(sotype(cfg), cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	sa := &unix.SockaddrVM{CID: cid, Port: port}
-	rsa, err := c.Connect(context.Background(), sa)
+	// Be sure to close the Conn if any of the system calls fail before we
+	// return the Conn to the caller.
+
+	if err := setConfig(c, cfg); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	var zc *zeroCopy
+	if cfg.ZeroCopy {
+		if zc, err = enableZeroCopy(c); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	if d.Control != nil {
+		rc, err := c.SyscallConn()
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+
+		if err := d.Control(network, raddr.String(), rc); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	if d.LocalAddr != nil {
+		lsa := sockaddr(d.LocalAddr)
+		if lsa.Port == 0 {
+			lsa.Port = unix.VMADDR_PORT_ANY
+		}
+
+		if err := c.Bind(lsa); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	sa := sockaddr(raddr)
+	rsa, err := c.Connect(ctx, sa)
 	if err != nil {
 		_ = c.Close()
 		return nil, err
@@ -44,18 +93,427 @@ func dial(cid, port uint32, _ *Config) (*Conn, error) {
 		return nil, err
 	}
 
-	lsavm := lsa.(*unix.SockaddrVM)
-	rsavm := rsa.(*unix.SockaddrVM)
+	return &Conn{
+		c:      c,
+		local:  newAddr(lsa.(*unix.SockaddrVM)),
+		remote: newAddr(rsa.(*unix.SockaddrVM)),
+		zc:     zc,
+	}, nil
+}
+
+// fileConn is the entry point for FileConn on Linux.
+func fileConn(f *os.File) (*Conn, error) {
+	c, err := socket.FileConn(f, name)
+	if err != nil {
+		return nil, err
+	}
+
+	lsa, err := c.Getsockname()
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	// Verify the address family so we don't accidentally create a *vsock.Conn
+	// backed by TCP or some other socket type.
+	lsavm, ok := lsa.(*unix.SockaddrVM)
+	if !ok {
+		_ = c.Close()
+
+		// All errors should wrapped with os.SyscallError.
+		return nil, os.NewSyscallError("file", unix.EINVAL)
+	}
+
+	// A connection must also have a peer, which rules out listeners.
+	rsa, err := c.Getpeername()
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
 
 	return &Conn{
-		c: c,
-		local: &Addr{
-			ContextID: lsavm.CID,
-			Port:      lsavm.Port,
-		},
-		remote: &Addr{
-			ContextID: rsavm.CID,
-			Port:      rsavm.Port,
-		},
+		c:      c,
+		local:  newAddr(lsavm),
+		remote: newAddr(rsa.(*unix.SockaddrVM)),
 	}, nil
 }
+
+// dupFile duplicates the file descriptor of c into a new os.File with name.
+func dupFile(c *socket.Conn, name string) (*os.File, error) {
+	var (
+		fd   int
+		derr error
+	)
+
+	err := control(c, func(cfd int) {
+		fd, derr = unix.FcntlInt(uintptr(cfd), unix.F_DUPFD_CLOEXEC, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if derr != nil {
+		return nil, os.NewSyscallError("fcntl", derr)
+	}
+
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// sotype returns the socket type specified by cfg.
+func sotype(cfg *Config) int {
+	if cfg.Seqpacket {
+		return unix.SOCK_SEQPACKET
+	}
+
+	return unix.SOCK_STREAM
+}
+
+// errNetNSConflict is returned when both Config.NetNS and Config.NetNSPath are
+// set.
+var errNetNSConflict = errors.New("only one of Config.NetNS and Config.NetNSPath may be set")
+
+// newSocket creates a VM socket of type typ in the network namespace specified
+// by cfg, if any.
+func newSocket(typ int, cfg *Config) (*socket.Conn, error) {
+	netns := cfg.NetNS
+	if cfg.NetNSPath != "" {
+		if cfg.NetNS != 0 {
+			return nil, errNetNSConflict
+		}
+
+		// The namespace file is only needed to create the socket, which
+		// remains in the namespace after the file is closed.
+		f, err := os.Open(cfg.NetNSPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open network namespace: %w", err)
+		}
+		defer f.Close()
+
+		netns = int(f.Fd())
+	}
+
+	return socket.Socket(unix.AF_VSOCK, typ, 0, name, &socket.Config{
+		NetNS: netns,
+	})
+}
+
+// setConfig applies the socket options specified by cfg to c.
+func setConfig(c *socket.Conn, cfg *Config) error {
+	// The kernel clamps the buffer size between the minimum and maximum, so
+	// the limits must be set first.
+	opts := []struct {
+		name  int
+		value uint64
+	}{
+		{name: unix.SO_VM_SOCKETS_BUFFER_MAX_SIZE, value: cfg.BufferMaxSize},
+		{name: unix.SO_VM_SOCKETS_BUFFER_MIN_SIZE, value: cfg.BufferMinSize},
+		{name: unix.SO_VM_SOCKETS_BUFFER_SIZE, value: cfg.BufferSize},
+	}
+
+	for _, o := range opts {
+		if o.value == 0 {
+			// Use the kernel default.
+			continue
+		}
+
+		if err := setsockoptUint64(c, o.name, o.value); err != nil {
+			return err
+		}
+	}
+
+	if cfg.ConnectTimeout != 0 {
+		tv := unix.NsecToTimeval(cfg.ConnectTimeout.Nanoseconds())
+
+		var serr error
+		err := control(c, func(fd int) {
+			serr = unix.SetsockoptTimeval(fd, unix.AF_VSOCK, unix.SO_VM_SOCKETS_CONNECT_TIMEOUT, &tv)
+		})
+		if err != nil {
+			return err
+		}
+		if serr != nil {
+			return os.NewSyscallError("setsockopt", serr)
+		}
+	}
+
+	return nil
+}
+
+// connectTimeout is the entry point for Conn.ConnectTimeout on Linux.
+func connectTimeout(c *conn) (time.Duration, error) {
+	var (
+		tv   *unix.Timeval
+		gerr error
+	)
+
+	err := control(c, func(fd int) {
+		tv, gerr = unix.GetsockoptTimeval(fd, unix.AF_VSOCK, unix.SO_VM_SOCKETS_CONNECT_TIMEOUT)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if gerr != nil {
+		return 0, os.NewSyscallError("getsockopt", gerr)
+	}
+
+	return time.Duration(tv.Nano()), nil
+}
+
+// bufferSize is the entry point for Conn.BufferSize on Linux.
+func bufferSize(c *conn) (uint64, error) {
+	return getsockoptUint64(c, unix.SO_VM_SOCKETS_BUFFER_SIZE)
+}
+
+// setBufferSize is the entry point for Conn.SetBufferSize on Linux.
+func setBufferSize(c *conn, n uint64) error {
+	maxSize, err := getsockoptUint64(c, unix.SO_VM_SOCKETS_BUFFER_MAX_SIZE)
+	if err != nil {
+		return err
+	}
+	if n > maxSize {
+		if err := setsockoptUint64(c, unix.SO_VM_SOCKETS_BUFFER_MAX_SIZE, n); err != nil {
+			return err
+		}
+	}
+
+	minSize, err := getsockoptUint64(c, unix.SO_VM_SOCKETS_BUFFER_MIN_SIZE)
+	if err != nil {
+		return err
+	}
+	if n < minSize {
+		if err := setsockoptUint64(c, unix.SO_VM_SOCKETS_BUFFER_MIN_SIZE, n); err != nil {
+			return err
+		}
+	}
+
+	return setsockoptUint64(c, unix.SO_VM_SOCKETS_BUFFER_SIZE, n)
+}
+
+// getsockoptUint64 retrieves a uint64 AF_VSOCK socket option from c.
+func getsockoptUint64(c *socket.Conn, name int) (uint64, error) {
+	var (
+		v    uint64
+		gerr error
+	)
+
+	err := control(c, func(fd int) {
+		v, gerr = unix.GetsockoptUint64(fd, unix.AF_VSOCK, name)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return v, os.NewSyscallError("getsockopt", gerr)
+}
+
+// setsockoptUint64 sets a uint64 AF_VSOCK socket option on c.
+func setsockoptUint64(c *socket.Conn, name int, v uint64) error {
+	var serr error
+	err := control(c, func(fd int) {
+		serr = unix.SetsockoptUint64(fd, unix.AF_VSOCK, name, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.NewSyscallError("setsockopt", serr)
+}
+
+// control invokes fn with the file descriptor of c.
+func control(c *socket.Conn, fn func(fd int)) error {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	return rc.Control(func(fd uintptr) { fn(int(fd)) })
+}
+
+// readMsg is the entry point for Conn.ReadMsg on Linux.
+func readMsg(c *conn, b []byte) (int, MsgFlags, error) {
+	n, _, rflags, _, err := c.Recvmsg(context.Background(), b, nil, 0)
+	if err != nil {
+		return n, 0, err
+	}
+
+	var flags MsgFlags
+	if rflags&unix.MSG_TRUNC != 0 {
+		flags |= MsgTruncated
+	}
+	if rflags&unix.MSG_EOR != 0 {
+		flags |= MsgEOR
+	}
+
+	if n == 0 && flags == 0 && len(b) > 0 {
+		// Like Read, an empty read with no message to report means the peer
+		// has shut down the connection.
+		return 0, 0, io.EOF
+	}
+
+	return n, flags, nil
+}
+
+// writeMsg is the entry point for Conn.WriteMsg on Linux.
+func writeMsg(c *conn, b []byte) (int, error) {
+	return c.Sendmsg(context.Background(), b, nil, nil, unix.MSG_EOR)
+}
+
+// maxIovecs is IOV_MAX, the maximum number of buffers which may be passed to a
+// single readv(2) or writev(2) system call.
+const maxIovecs = 1024
+
+// writeBuffers is the entry point for Conn.WriteBuffers on Linux.
+func writeBuffers(c *conn, bufs net.Buffers) (int64, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		n    int64
+		werr error
+	)
+
+	// Copy bufs so consuming the written data doesn't modify the caller's
+	// buffers, and drop any leading empty buffers so a write of nothing
+	// completes without any system calls.
+	bufs = append(net.Buffers(nil), bufs...)
+	consume(&bufs, 0)
+
+	err = rc.Write(func(fd uintptr) bool {
+		for len(bufs) > 0 {
+			iovs := bufs
+			if len(iovs) > maxIovecs {
+				iovs = iovs[:maxIovecs]
+			}
+
+			nn, err := unix.Writev(int(fd), iovs)
+			if nn > 0 {
+				n += int64(nn)
+				consume(&bufs, nn)
+			}
+
+			switch {
+			case errors.Is(err, unix.EINTR):
+				continue
+			case errors.Is(err, unix.EAGAIN):
+				return false
+			case err != nil:
+				werr = os.NewSyscallError("writev", err)
+				return true
+			}
+		}
+
+		return true
+	})
+	if werr != nil {
+		return n, werr
+	}
+
+	return n, err
+}
+
+// consume removes n bytes from the front of bufs, along with any buffers which
+// are empty as a result.
+func consume(bufs *net.Buffers, n int) {
+	for len(*bufs) > 0 {
+		b := (*bufs)[0]
+		if n < len(b) {
+			(*bufs)[0] = b[n:]
+			if len((*bufs)[0]) > 0 {
+				return
+			}
+		}
+
+		n -= len(b)
+		*bufs = (*bufs)[1:]
+	}
+}
+
+// readBuffers is the entry point for Conn.ReadBuffers on Linux.
+func readBuffers(c *conn, bufs [][]byte) (int64, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(bufs) > maxIovecs {
+		bufs = bufs[:maxIovecs]
+	}
+
+	var (
+		n    int
+		rerr error
+	)
+
+	err = rc.Read(func(fd uintptr) bool {
+		for {
+			n, rerr = unix.Readv(int(fd), bufs)
+			switch {
+			case errors.Is(rerr, unix.EINTR):
+				continue
+			case errors.Is(rerr, unix.EAGAIN):
+				return false
+			case rerr != nil:
+				rerr = os.NewSyscallError("readv", rerr)
+			}
+
+			return true
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if rerr != nil {
+		return 0, rerr
+	}
+
+	if n == 0 {
+		// Like Read, a zero-byte read indicates EOF as long as there was room
+		// to read some data.
+		for _, b := range bufs {
+			if len(b) > 0 {
+				return 0, io.EOF
+			}
+		}
+	}
+
+	return int64(n), nil
+}
+
+// queueDepths is the entry point for Conn.Stats on Linux. It returns the number
+// of bytes in the receive and send queues, or -1 for either if unsupported.
+func queueDepths(c *conn) (int, int, error) {
+	var (
+		inq, outq = -1, -1
+		ierr      error
+	)
+
+	err := control(c, func(fd int) {
+		for _, q := range []struct {
+			req uint
+			v   *int
+		}{
+			{req: unix.SIOCINQ, v: &inq},
+			{req: unix.SIOCOUTQ, v: &outq},
+		} {
+			n, err := unix.IoctlGetInt(fd, q.req)
+			switch {
+			case err == nil:
+				*q.v = n
+			case errors.Is(err, unix.ENOTTY), errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, unix.EINVAL):
+				// Not supported by the kernel or transport.
+			default:
+				ierr = os.NewSyscallError("ioctl", err)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if ierr != nil {
+		return 0, 0, ierr
+	}
+
+	return inq, outq, nil
+}
@@ -7,4 +7,5 @@
 //   - *Addr implements net.Addr
 //   - *Conn implements net.Conn
 //   - *Listener implements net.Listener
+//   - *PacketConn implements net.PacketConn
 package vsock
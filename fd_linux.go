@@ -1,6 +1,7 @@
 package vsock
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -18,6 +19,12 @@ func contextID() (uint32, error) {
 	return unix.IoctlGetUint32(int(f.Fd()), unix.IOCTL_VM_SOCKETS_GET_LOCAL_CID)
 }
 
+// newAddr creates an Addr from a unix.SockaddrVM.
+func newAddr(sa *unix.SockaddrVM) *Addr { return AddrPortFromSockaddr(sa).Addr() }
+
+// sockaddr creates a unix.SockaddrVM from an Addr.
+func sockaddr(a *Addr) *unix.SockaddrVM { return a.AddrPort().Sockaddr() }
+
 // isErrno determines if an error a matches UNIX error number.
 func isErrno(err error, errno int) bool {
 	switch errno {
@@ -25,12 +32,43 @@ func isErrno(err error, errno int) bool {
 		return err == unix.EBADF
 	case enotconn:
 		return err == unix.ENOTCONN
+	case etimedout:
+		// connect(2) errors are wrapped in *os.SyscallError.
+		return errors.Is(err, unix.ETIMEDOUT)
+	case econnreset:
+		return errors.Is(err, unix.ECONNRESET)
 	default:
 		panicf("vsock: isErrno called with unhandled error number parameter: %d", errno)
 		return false
 	}
 }
 
+// errorSentinel returns the sentinel error which classifies err for op, or nil
+// if none applies.
+func errorSentinel(op string, err error) error {
+	var perr *os.PathError
+	switch {
+	case errors.Is(err, unix.ENOENT) && errors.As(err, &perr) && perr.Path == devVsock,
+		errors.Is(err, unix.ENODEV), errors.Is(err, unix.EAFNOSUPPORT):
+		return ErrNoDevice
+	case errors.Is(err, unix.EACCES), errors.Is(err, unix.EPERM):
+		return ErrPermission
+	case errors.Is(err, unix.ECONNREFUSED),
+		// Most transports reset a connection attempt when nothing is
+		// listening.
+		op == opDial && errors.Is(err, unix.ECONNRESET):
+		return ErrConnectionRefused
+	case errors.Is(err, unix.ENETUNREACH), errors.Is(err, unix.EHOSTUNREACH):
+		return ErrHostUnreachable
+	case errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, unix.ESOCKTNOSUPPORT),
+		errors.Is(err, unix.EPROTONOSUPPORT), errors.Is(err, unix.ENOPROTOOPT),
+		errors.Is(err, unix.ENOSYS):
+		return ErrUnsupported
+	default:
+		return nil
+	}
+}
+
 func panicf(format string, a ...any) {
 	panic(fmt.Sprintf(format, a...))
 }
@@ -0,0 +1,114 @@
+package vsock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mdlayher/vsock/internal/vserr"
+)
+
+// maxHybridResponse is the maximum length of a hybrid vsock handshake response
+// line, which is far longer than any valid response.
+const maxHybridResponse = 64
+
+// DialHybrid dials a VM sockets listener in a virtual machine using the hybrid
+// vsock protocol implemented by virtual machine monitors such as Firecracker
+// and Cloud Hypervisor. These monitors have no AF_VSOCK device on the host, and
+// instead expose each guest's VM sockets through a UNIX socket on the host at
+// path. The contextID parameter specifies the context ID configured for the
+// guest's hybrid vsock device, and port specifies the port of the listener in
+// the guest.
+//
+// DialHybrid connects to the UNIX socket and performs the handshake by sending
+// "CONNECT <port>\n" and reading "OK <hostport>\n". The returned Conn's
+// LocalAddr reports Host and the host port assigned by the monitor, and its
+// RemoteAddr reports contextID and port. The monitor does not convey the
+// guest's context ID, so contextID is only used to report addresses.
+//
+// If the monitor closes the connection during the handshake, typically because
+// nothing is listening on port in the guest, the error matches
+// ErrConnectionRefused. Because the Conn is backed by a UNIX socket, methods
+// specific to VM sockets such as BufferSize return errors which match
+// ErrUnsupported.
+func DialHybrid(ctx context.Context, path string, contextID, port uint32) (*Conn, error) {
+	c, err := dialHybrid(ctx, path, contextID, port)
+	if err != nil {
+		// No local address, but we have a remote address we can return.
+		return nil, opError(opDial, err, nil, &Addr{
+			ContextID: contextID,
+			Port:      port,
+		})
+	}
+
+	return c, nil
+}
+
+// ListenHybrid opens a connection-oriented net.Listener for incoming hybrid
+// vsock connections from a virtual machine monitor such as Firecracker, on
+// behalf of a guest dialing Host on port. The path and contextID parameters
+// specify the UNIX socket path and context ID configured for the guest's hybrid
+// vsock device, and the Listener creates its socket at "<path>_<port>" where
+// the monitor expects it. The socket file is removed when the Listener is
+// closed.
+//
+// The Listener's Addr reports Host and port, so existing server code written
+// for Listen works unchanged. The monitor does not convey the guest's context
+// ID or port when it connects, so the RemoteAddr of each accepted Conn reports
+// contextID and the wildcard port VMADDR_PORT_ANY.
+//
+// Because the Listener and its Conns are backed by UNIX sockets, methods
+// specific to VM sockets such as Conn.BufferSize return errors which match
+// ErrUnsupported. The port must be non-zero.
+func ListenHybrid(path string, contextID, port uint32) (*Listener, error) {
+	l, err := listenHybrid(path, contextID, port)
+	if err != nil {
+		// No remote address available.
+		return nil, opError(opListen, err, &Addr{
+			ContextID: Host,
+			Port:      port,
+		}, nil)
+	}
+
+	return l, nil
+}
+
+// hybridPath returns the UNIX socket path used by a monitor to connect to a
+// hybrid vsock listener on port.
+func hybridPath(path string, port uint32) string {
+	return fmt.Sprintf("%s_%d", path, port)
+}
+
+// errHybridPort is returned when a hybrid vsock listener is created without a
+// port, which cannot be automatically assigned.
+var errHybridPort = errors.New("hybrid vsock listener requires a non-zero port")
+
+// errHybridClosed indicates that the monitor closed the connection during the
+// hybrid vsock handshake.
+var errHybridClosed = vserr.WithSentinel(
+	errors.New("hybrid vsock handshake: connection closed by peer"),
+	ErrConnectionRefused,
+)
+
+// hybridConnect returns the hybrid vsock handshake request for port.
+func hybridConnect(port uint32) []byte {
+	return fmt.Appendf(nil, "CONNECT %d\n", port)
+}
+
+// parseHybridResponse parses a hybrid vsock handshake response line, without
+// its trailing newline, and returns the host port.
+func parseHybridResponse(s string) (uint32, error) {
+	sport, ok := strings.CutPrefix(s, "OK ")
+	if !ok {
+		return 0, fmt.Errorf("hybrid vsock handshake: unexpected response %q", s)
+	}
+
+	port, err := strconv.ParseUint(sport, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("hybrid vsock handshake: invalid port in response %q", s)
+	}
+
+	return uint32(port), nil
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package vsock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mdlayher/socket"
+	"golang.org/x/sys/unix"
+)
+
+// hybridName is the socket name passed to package socket for hybrid vsock
+// UNIX sockets.
+const hybridName = "vsock-hybrid"
+
+// dialHybrid is the entry point for DialHybrid on Linux.
+func dialHybrid(ctx context.Context, path string, contextID, port uint32) (*Conn, error) {
+	c, err := socket.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0, hybridName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Be sure to close the Conn if any of the system calls or the handshake
+	// fail before we return the Conn to the caller.
+
+	if _, err := c.Connect(ctx, &unix.SockaddrUnix{Name: path}); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	hostPort, err := hybridHandshake(ctx, c, port)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return &Conn{
+		c:      c,
+		local:  &Addr{ContextID: Host, Port: hostPort},
+		remote: &Addr{ContextID: contextID, Port: port},
+		hybrid: true,
+	}, nil
+}
+
+// hybridHandshake performs the client side of the hybrid vsock handshake on c
+// and returns the host port assigned by the monitor.
+func hybridHandshake(ctx context.Context, c *socket.Conn, port uint32) (uint32, error) {
+	if _, err := c.WriteContext(ctx, hybridConnect(port)); err != nil {
+		return 0, err
+	}
+
+	// Read one byte at a time so that no data sent by the guest after the
+	// response is consumed.
+	var (
+		line []byte
+		b    [1]byte
+	)
+
+	for {
+		if _, err := c.ReadContext(ctx, b[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, errHybridClosed
+			}
+
+			return 0, err
+		}
+
+		if b[0] == '\n' {
+			return parseHybridResponse(string(line))
+		}
+
+		line = append(line, b[0])
+		if len(line) > maxHybridResponse {
+			return 0, fmt.Errorf("hybrid vsock handshake: response too long: %q...", line)
+		}
+	}
+}
+
+// listenHybrid is the entry point for ListenHybrid on Linux.
+func listenHybrid(path string, contextID, port uint32) (*Listener, error) {
+	if port == 0 {
+		return nil, errHybridPort
+	}
+
+	c, err := socket.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0, hybridName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Be sure to close the Conn if any of the system calls fail before we
+	// return the Conn to the caller.
+
+	lpath := hybridPath(path, port)
+	if err := c.Bind(&unix.SockaddrUnix{Name: lpath}); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	if err := c.Listen(unix.SOMAXCONN); err != nil {
+		_ = c.Close()
+		_ = os.Remove(lpath)
+		return nil, err
+	}
+
+	return &Listener{
+		l: &listener{
+			c:     c,
+			addr:  &Addr{ContextID: Host, Port: port},
+			path:  lpath,
+			guest: contextID,
+		},
+	}, nil
+}
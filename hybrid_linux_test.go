@@ -0,0 +1,336 @@
+package vsock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+func TestDialHybrid(t *testing.T) {
+	// Stand in for the virtual machine monitor: accept a single connection,
+	// verify the handshake, and send data immediately after the response to
+	// verify that it isn't consumed by the handshake.
+	path := fakeHybridMonitor(t, func(c net.Conn, port uint32) {
+		if port != 1024 {
+			_, _ = fmt.Fprintf(c, "unexpected port %d\n", port)
+			return
+		}
+
+		_, _ = io.WriteString(c, "OK 1073741824\nhello")
+
+		// Echo back whatever the client writes until it half-closes.
+		_, _ = io.Copy(c, c)
+	})
+
+	c, err := DialHybrid(context.Background(), path, 3, 1024)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if diff := cmp.Diff(&Addr{ContextID: Host, Port: 1073741824}, c.LocalAddr()); diff != "" {
+		t.Fatalf("unexpected local address (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(&Addr{ContextID: 3, Port: 1024}, c.RemoteAddr()); diff != "" {
+		t.Fatalf("unexpected remote address (-want +got):\n%s", diff)
+	}
+
+	if _, err := io.WriteString(c, " world"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := c.CloseWrite(); err != nil {
+		t.Fatalf("failed to close write: %v", err)
+	}
+
+	b, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff("hello world", string(b)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+}
+
+func TestDialHybridErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		respond  func(c net.Conn)
+		sentinel error
+		message  string
+	}{
+		{
+			name:     "closed",
+			respond:  func(_ net.Conn) {},
+			sentinel: ErrConnectionRefused,
+		},
+		{
+			name: "bad response",
+			respond: func(c net.Conn) {
+				_, _ = io.WriteString(c, "NOPE\n")
+			},
+			message: `unexpected response "NOPE"`,
+		},
+		{
+			name: "too long",
+			respond: func(c net.Conn) {
+				_, _ = io.WriteString(c, strings.Repeat("A", 128))
+			},
+			message: "response too long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fakeHybridMonitor(t, func(c net.Conn, _ uint32) {
+				tt.respond(c)
+			})
+
+			_, err := DialHybrid(context.Background(), path, 3, 1024)
+
+			var oerr *net.OpError
+			if !errors.As(err, &oerr) {
+				t.Fatalf("expected *net.OpError, but got: %#v", err)
+			}
+			if oerr.Op != opDial {
+				t.Fatalf("unexpected op: %q", oerr.Op)
+			}
+
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Fatalf("expected %v, but got: %v", tt.sentinel, err)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("expected message containing %q, but got: %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestDialHybridContextCanceled(t *testing.T) {
+	// The monitor never responds, so the context deadline must interrupt the
+	// handshake.
+	path := fakeHybridMonitor(t, func(c net.Conn, _ uint32) {
+		_, _ = io.Copy(io.Discard, c)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := DialHybrid(ctx, path, 3, 1024)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded, but got: %v", err)
+	}
+}
+
+// fakeHybridMonitor starts a UNIX socket listener which acts like the hybrid
+// vsock endpoint of a virtual machine monitor. It parses the CONNECT request of
+// each client and then passes control to fn.
+func fakeHybridMonitor(t *testing.T, fn func(c net.Conn, port uint32)) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "vsock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		_ = l.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		line, err := bufio.NewReader(c).ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		var port uint32
+		if _, err := fmt.Sscanf(line, "CONNECT %d\n", &port); err != nil {
+			_, _ = fmt.Fprintf(c, "bad request %q\n", line)
+			return
+		}
+
+		fn(c, port)
+	}()
+
+	return path
+}
+
+func TestListenHybrid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vsock")
+
+	l, err := ListenHybrid(path, 3, 1024)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	if diff := cmp.Diff(&Addr{ContextID: Host, Port: 1024}, l.Addr()); diff != "" {
+		t.Fatalf("unexpected listener address (-want +got):\n%s", diff)
+	}
+
+	// Stand in for the virtual machine monitor, which connects to the
+	// listener's socket on behalf of the guest.
+	errC := make(chan error, 1)
+	go func() {
+		c, err := net.Dial("unix", path+"_1024")
+		if err != nil {
+			errC <- err
+			return
+		}
+		defer c.Close()
+
+		_, err = io.WriteString(c, "hello")
+		errC <- err
+	}()
+
+	// Accept through the net.Listener interface, as existing servers would.
+	var nl net.Listener = l
+	nc, err := nl.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer nc.Close()
+
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	c := nc.(*Conn)
+	if diff := cmp.Diff(&Addr{ContextID: Host, Port: 1024}, c.LocalAddr()); diff != "" {
+		t.Fatalf("unexpected local address (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(&Addr{ContextID: 3, Port: unix.VMADDR_PORT_ANY}, c.RemoteAddr()); diff != "" {
+		t.Fatalf("unexpected remote address (-want +got):\n%s", diff)
+	}
+
+	b, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(b)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+
+	// Closing the listener removes its socket.
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close listener: %v", err)
+	}
+	if _, err := os.Stat(path + "_1024"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected socket to be removed, but got: %v", err)
+	}
+}
+
+func TestListenHybridErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vsock")
+
+	if _, err := ListenHybrid(path, 3, 0); !errors.Is(err, errHybridPort) {
+		t.Fatalf("expected port error, but got: %v", err)
+	}
+
+	l, err := ListenHybrid(path, 3, 1024)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	// The socket is already in use.
+	_, err = ListenHybrid(path, 3, 1024)
+
+	var oerr *net.OpError
+	if !errors.As(err, &oerr) || !errors.Is(err, unix.EADDRINUSE) {
+		t.Fatalf("expected address in use *net.OpError, but got: %v", err)
+	}
+	if diff := cmp.Diff(&Addr{ContextID: Host, Port: 1024}, oerr.Addr); diff != "" {
+		t.Fatalf("unexpected error address (-want +got):\n%s", diff)
+	}
+}
+
+func TestHybridTransport(t *testing.T) {
+	path := fakeHybridMonitor(t, func(c net.Conn, port uint32) {
+		_, _ = fmt.Fprintf(c, "OK 1073741824\n%d", port)
+	})
+
+	var tr Transport = &Hybrid{Path: path, GuestContextID: 3}
+
+	cid, err := tr.ContextID()
+	if err != nil {
+		t.Fatalf("failed to get context ID: %v", err)
+	}
+	if diff := cmp.Diff(uint32(Host), cid); diff != "" {
+		t.Fatalf("unexpected context ID (-want +got):\n%s", diff)
+	}
+
+	c, err := tr.Dial(context.Background(), 3, 1024)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if diff := cmp.Diff(&Addr{ContextID: 3, Port: 1024}, c.RemoteAddr()); diff != "" {
+		t.Fatalf("unexpected remote address (-want +got):\n%s", diff)
+	}
+
+	b, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("1024", string(b)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+
+	l, err := tr.Listen(context.Background(), Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	if diff := cmp.Diff(&Addr{ContextID: Host, Port: 1024}, l.Addr()); diff != "" {
+		t.Fatalf("unexpected listener address (-want +got):\n%s", diff)
+	}
+
+	mc, err := net.Dial("unix", path+"_1024")
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+	defer mc.Close()
+
+	lc, err := l.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer lc.Close()
+
+	// Accepted connections report the guest context ID configured on the
+	// Transport.
+	if diff := cmp.Diff(&Addr{ContextID: 3, Port: unix.VMADDR_PORT_ANY}, lc.RemoteAddr()); diff != "" {
+		t.Fatalf("unexpected remote address (-want +got):\n%s", diff)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := tr.Listen(ctx, Host, 1025); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package vsock
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseHybridResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		port uint32
+		ok   bool
+	}{
+		{
+			name: "OK",
+			s:    "OK 1073741824",
+			port: 1073741824,
+			ok:   true,
+		},
+		{
+			name: "empty",
+		},
+		{
+			name: "no port",
+			s:    "OK ",
+		},
+		{
+			name: "bad port",
+			s:    "OK foo",
+		},
+		{
+			name: "port overflow",
+			s:    "OK 4294967296",
+		},
+		{
+			name: "lowercase",
+			s:    "ok 1024",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, err := parseHybridResponse(tt.s)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.port, port); diff != "" {
+				t.Fatalf("unexpected port (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
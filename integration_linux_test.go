@@ -3,22 +3,28 @@
 package vsock_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/mdlayher/vsock"
 	"github.com/mdlayher/vsock/internal/vsutil"
+	"github.com/mdlayher/vsock/vsocktest"
 	"golang.org/x/net/nettest"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sys/unix"
@@ -62,7 +68,7 @@ func TestIntegrationContextIDHost(t *testing.T) {
 }
 
 func TestIntegrationListenerUnblockAcceptTimeout(t *testing.T) {
-	l, done := newListener(t)
+	l, done := newListener(t, nil)
 	defer done()
 
 	if err := l.SetDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
@@ -202,6 +208,118 @@ func TestIntegrationConnSyscallConn(t *testing.T) {
 	}
 }
 
+func TestIntegrationConnSeqpacket(t *testing.T) {
+	l, done := newListener(t, &vsock.Config{Seqpacket: true})
+	defer done()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		c, err := l.AcceptVsock()
+		if err != nil {
+			return fmt.Errorf("failed to accept: %v", err)
+		}
+		defer c.Close()
+
+		// Send two messages which must be received individually.
+		for _, msg := range []string{"hello", "world!"} {
+			if _, err := c.WriteMsg([]byte(msg)); err != nil {
+				return fmt.Errorf("failed to write message: %v", err)
+			}
+		}
+
+		return nil
+	})
+
+	addr := l.Addr().(*vsock.Addr)
+	c, err := vsock.Dial(addr.ContextID, addr.Port, &vsock.Config{Seqpacket: true})
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+	defer c.Close()
+
+	// The first message fits exactly, the second is truncated. Both end a
+	// record.
+	b := make([]byte, 5)
+	for _, want := range []struct {
+		s     string
+		flags vsock.MsgFlags
+	}{
+		{s: "hello", flags: vsock.MsgEOR},
+		{s: "world", flags: vsock.MsgTruncated | vsock.MsgEOR},
+	} {
+		n, flags, err := c.ReadMsg(b)
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+
+		if diff := cmp.Diff(want.s, string(b[:n])); diff != "" {
+			t.Fatalf("unexpected message (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(want.flags, flags); diff != "" {
+			t.Fatalf("unexpected flags (-want +got):\n%s", diff)
+		}
+	}
+
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to wait for listener goroutine: %v", err)
+	}
+
+	// The listener's connection is closed after writing.
+	if _, _, err := c.ReadMsg(b); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+}
+
+func TestIntegrationPacketConn(t *testing.T) {
+	// Bind to Local for both PacketConns to avoid the need to run a hypervisor
+	// and VM setup.
+	listen := func() *vsock.PacketConn {
+		c, err := vsock.ListenPacket(vsock.Local, 0, nil)
+		if err != nil {
+			vsutil.SkipDeviceError(t, err)
+
+			// Datagram sockets are unsupported by most transports.
+			var serr *os.SyscallError
+			if errors.As(err, &serr) {
+				switch serr.Err {
+				case unix.ENODEV, unix.ESOCKTNOSUPPORT, unix.EADDRNOTAVAIL:
+					t.Skipf("skipping, datagram VM sockets are unsupported: %v", err)
+				}
+			}
+
+			t.Fatalf("failed to listen packet: %v", err)
+		}
+
+		return c
+	}
+
+	c1, c2 := listen(), listen()
+	defer c1.Close()
+	defer c2.Close()
+
+	if err := c2.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	const msg = "hello, world"
+	if _, err := c1.WriteTo([]byte(msg), c2.LocalAddr()); err != nil {
+		t.Fatalf("failed to write datagram: %v", err)
+	}
+
+	b := make([]byte, 64)
+	n, addr, err := c2.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read datagram: %v", err)
+	}
+
+	if diff := cmp.Diff(msg, string(b[:n])); diff != "" {
+		t.Fatalf("unexpected datagram (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(c1.LocalAddr(), addr); diff != "" {
+		t.Fatalf("unexpected sender address (-want +got):\n%s", diff)
+	}
+}
+
 func TestIntegrationConnDialNoListener(t *testing.T) {
 	// Dial out to vsock listeners which do not exist, and expect an immediate
 	// error rather than hanging. This mostly relies on changes to the
@@ -244,6 +362,323 @@ func TestIntegrationConnDialNoListener(t *testing.T) {
 	}
 }
 
+func TestIntegrationDialContextCanceled(t *testing.T) {
+	// An already canceled context must prevent any connection attempt, no
+	// matter whether a listener exists.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := vsock.DialContext(ctx, vsock.Local, 1024, nil)
+	if err == nil {
+		t.Fatal("dial succeeded, but should not have")
+	}
+
+	vsutil.SkipDeviceError(t, err)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled error, but got: %v", err)
+	}
+
+	want := &vsock.Addr{ContextID: vsock.Local, Port: 1024}
+	if diff := cmp.Diff(want, err.(*net.OpError).Addr); diff != "" {
+		t.Fatalf("unexpected error address (-want +got):\n%s", diff)
+	}
+}
+
+func TestIntegrationDialerControl(t *testing.T) {
+	errControl := errors.New("control error")
+
+	d := &vsock.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			if network != "vsock" || address != "local(1):1024" {
+				return fmt.Errorf("unexpected network and address: %q, %q", network, address)
+			}
+
+			return errControl
+		},
+	}
+
+	_, err := d.DialContext(context.Background(), "vsock", "1:1024")
+	vsutil.SkipDeviceError(t, err)
+
+	if !errors.Is(err, errControl) {
+		t.Fatalf("expected control error, but got: %v", err)
+	}
+}
+
+func TestIntegrationListenConfigContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var lc vsock.ListenConfig
+	_, err := lc.Listen(ctx, vsock.Local, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled error, but got: %v", err)
+	}
+}
+
+func TestIntegrationListenConfigControl(t *testing.T) {
+	errControl := errors.New("control error")
+
+	lc := &vsock.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			if network != "vsock" || address != "local(1):1024" {
+				return fmt.Errorf("unexpected network and address: %q, %q", network, address)
+			}
+
+			// Options may be set on the socket before it is bound.
+			var serr error
+			err := c.Control(func(fd uintptr) {
+				serr = unix.SetsockoptUint64(int(fd), unix.AF_VSOCK,
+					unix.SO_VM_SOCKETS_BUFFER_MAX_SIZE, 64)
+			})
+			if err != nil {
+				return err
+			}
+			if serr != nil {
+				return serr
+			}
+
+			return errControl
+		},
+	}
+
+	_, err := lc.Listen(context.Background(), vsock.Local, 1024)
+	vsutil.SkipDeviceError(t, err)
+
+	if !errors.Is(err, errControl) {
+		t.Fatalf("expected control error, but got: %v", err)
+	}
+}
+
+func TestIntegrationListenConfigBufferSize(t *testing.T) {
+	const (
+		size    uint64 = 1 << 20
+		minSize uint64 = 1 << 10
+		maxSize uint64 = 1 << 21
+	)
+
+	// The buffer size options are applied before Control is invoked, so
+	// Control can be used to observe them.
+	opts := make(map[int]uint64)
+	lc := &vsock.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var gerr error
+			err := c.Control(func(fd uintptr) {
+				for _, name := range []int{
+					unix.SO_VM_SOCKETS_BUFFER_SIZE,
+					unix.SO_VM_SOCKETS_BUFFER_MIN_SIZE,
+					unix.SO_VM_SOCKETS_BUFFER_MAX_SIZE,
+				} {
+					opts[name], gerr = unix.GetsockoptUint64(int(fd), unix.AF_VSOCK, name)
+					if gerr != nil {
+						return
+					}
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			return gerr
+		},
+		Config: &vsock.Config{
+			BufferSize:    size,
+			BufferMinSize: minSize,
+			BufferMaxSize: maxSize,
+		},
+	}
+
+	l, err := lc.Listen(context.Background(), unix.VMADDR_CID_ANY, 0)
+	if err != nil {
+		vsutil.SkipDeviceError(t, err)
+
+		t.Fatalf("failed to listen: %v", err)
+	}
+	_ = l.Close()
+
+	want := map[int]uint64{
+		unix.SO_VM_SOCKETS_BUFFER_SIZE:     size,
+		unix.SO_VM_SOCKETS_BUFFER_MIN_SIZE: minSize,
+		unix.SO_VM_SOCKETS_BUFFER_MAX_SIZE: maxSize,
+	}
+
+	if diff := cmp.Diff(want, opts); diff != "" {
+		t.Fatalf("unexpected socket options (-want +got):\n%s", diff)
+	}
+}
+
+func TestIntegrationConnSetBufferSize(t *testing.T) {
+	l, done := newListener(t, &vsock.Config{BufferSize: 64 << 10})
+	defer done()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		c, err := l.AcceptVsock()
+		if err != nil {
+			return fmt.Errorf("failed to accept: %v", err)
+		}
+		defer c.Close()
+
+		// Accepted Conns inherit the Listener's buffer size.
+		n, err := c.BufferSize()
+		if err != nil {
+			return fmt.Errorf("failed to get accepted buffer size: %v", err)
+		}
+		if n != 64<<10 {
+			return fmt.Errorf("unexpected accepted buffer size: %d", n)
+		}
+
+		return nil
+	})
+
+	addr := l.Addr().(*vsock.Addr)
+	c, err := vsock.Dial(addr.ContextID, addr.Port, nil)
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+	defer c.Close()
+
+	// Grow the buffer beyond the default maximum.
+	const size = 4 << 20
+	if err := c.SetBufferSize(size); err != nil {
+		t.Fatalf("failed to set buffer size: %v", err)
+	}
+
+	n, err := c.BufferSize()
+	if err != nil {
+		t.Fatalf("failed to get buffer size: %v", err)
+	}
+	if diff := cmp.Diff(uint64(size), n); diff != "" {
+		t.Fatalf("unexpected buffer size (-want +got):\n%s", diff)
+	}
+
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to wait for listener goroutine: %v", err)
+	}
+}
+
+func TestIntegrationDialerConnectTimeout(t *testing.T) {
+	const timeout = 10 * time.Second
+
+	// The connect timeout is applied before Control is invoked, so Control can
+	// be used to observe it without actually connecting.
+	var (
+		errControl = errors.New("control error")
+		got        time.Duration
+	)
+
+	d := &vsock.Dialer{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var gerr error
+			err := c.Control(func(fd uintptr) {
+				var tv *unix.Timeval
+				tv, gerr = unix.GetsockoptTimeval(int(fd), unix.AF_VSOCK,
+					unix.SO_VM_SOCKETS_CONNECT_TIMEOUT)
+				if gerr == nil {
+					got = time.Duration(tv.Nano())
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if gerr != nil {
+				return gerr
+			}
+
+			return errControl
+		},
+		Config: &vsock.Config{ConnectTimeout: timeout},
+	}
+
+	_, err := d.DialVsock(context.Background(), vsock.Local, 1024)
+	vsutil.SkipDeviceError(t, err)
+
+	if !errors.Is(err, errControl) {
+		t.Fatalf("expected control error, but got: %v", err)
+	}
+
+	if diff := cmp.Diff(timeout, got); diff != "" {
+		t.Fatalf("unexpected connect timeout (-want +got):\n%s", diff)
+	}
+}
+
+func TestIntegrationDialerHTTPTransport(t *testing.T) {
+	// http.Transport always dials the "tcp" network. Fail the dial after the
+	// socket is created to verify the request reaches the VM sockets dialer
+	// without requiring a listener.
+	errControl := errors.New("control error")
+	d := &vsock.Dialer{
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if network != "vsock" || address != "vm(3):1024" {
+				return fmt.Errorf("unexpected network and address: %q, %q", network, address)
+			}
+
+			return errControl
+		},
+	}
+
+	tr := &http.Transport{DialContext: d.DialContext}
+	defer tr.CloseIdleConnections()
+
+	_, err := (&http.Client{Transport: tr}).Get("http://3:1024/")
+	vsutil.SkipDeviceError(t, err)
+
+	if !errors.Is(err, errControl) {
+		t.Fatalf("expected control error, but got: %v", err)
+	}
+}
+
+func TestIntegrationDialerNetNS(t *testing.T) {
+	// Enter the calling thread's own network namespace, which exercises the
+	// namespace logic without requiring any additional setup.
+	path := fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid())
+	f, err := os.Open(path)
+	if err != nil {
+		t.Skipf("skipping, failed to open network namespace: %v", err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name string
+		cfg  *vsock.Config
+	}{
+		{
+			name: "file descriptor",
+			cfg:  &vsock.Config{NetNS: int(f.Fd())},
+		},
+		{
+			// All threads in this process share a network namespace, so the
+			// path may be opened from any thread.
+			name: "path",
+			cfg:  &vsock.Config{NetNSPath: path},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errControl := errors.New("control error")
+			d := &vsock.Dialer{
+				Control: func(_, _ string, _ syscall.RawConn) error {
+					return errControl
+				},
+				Config: tt.cfg,
+			}
+
+			_, err := d.DialVsock(context.Background(), vsock.Local, 1024)
+			vsutil.SkipDeviceError(t, err)
+
+			if errors.Is(err, unix.EPERM) {
+				t.Skipf("skipping, permission denied entering network namespace: %v", err)
+			}
+
+			if !errors.Is(err, errControl) {
+				t.Fatalf("expected control error, but got: %v", err)
+			}
+		})
+	}
+}
+
 func TestIntegrationFileListenerOK(t *testing.T) {
 	// Use raw system calls to set up the socket for FileListener. Although the
 	// socket library does the heavy lifting, we want to verify that this also
@@ -343,6 +778,415 @@ func TestIntegrationFileListenerInvalid(t *testing.T) {
 	}
 }
 
+func TestIntegrationListenerFile(t *testing.T) {
+	// Binding to the wildcard CID doesn't require loopback support, so this
+	// works in more environments than the Local listener tests.
+	l, err := vsock.ListenAny(0, nil)
+	vsutil.SkipDeviceError(t, err)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	f, err := l.File()
+	if err != nil {
+		t.Fatalf("failed to get listener file: %v", err)
+	}
+	defer f.Close()
+
+	fl, err := vsock.FileListener(f)
+	if err != nil {
+		t.Fatalf("failed to open file listener: %v", err)
+	}
+	defer fl.Close()
+
+	if diff := cmp.Diff(l.Addr(), fl.Addr()); diff != "" {
+		t.Fatalf("unexpected listener address (-want +got):\n%s", diff)
+	}
+
+	// Closing the original listener must not affect the duplicate.
+	_ = l.Close()
+	if err := fl.SetDeadline(time.Now()); err != nil {
+		t.Fatalf("failed to set deadline on duplicate listener: %v", err)
+	}
+}
+
+func TestIntegrationListenerSyscallConn(t *testing.T) {
+	l, err := vsock.ListenAny(0, nil)
+	vsutil.SkipDeviceError(t, err)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	rc, err := l.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to get syscall conn: %v", err)
+	}
+
+	var (
+		acc  int
+		aerr error
+	)
+	err = rc.Control(func(fd uintptr) {
+		acc, aerr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ACCEPTCONN)
+	})
+	if err != nil {
+		t.Fatalf("failed to control: %v", err)
+	}
+	if aerr != nil {
+		t.Fatalf("failed to get SO_ACCEPTCONN: %v", aerr)
+	}
+	if acc != 1 {
+		t.Fatalf("expected a listening socket, but got SO_ACCEPTCONN: %d", acc)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close listener: %v", err)
+	}
+
+	// Errors after close must be reported using the Listener's address.
+	err = rc.Control(func(_ uintptr) {
+		panic("control should not be called")
+	})
+
+	var oerr *net.OpError
+	if !errors.As(err, &oerr) || !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closed *net.OpError, but got: %#v", err)
+	}
+	if oerr.Op != "raw-control" || oerr.Addr != l.Addr() {
+		t.Fatalf("unexpected op and address: %q, %v", oerr.Op, oerr.Addr)
+	}
+}
+
+func TestIntegrationListenAny(t *testing.T) {
+	l, err := vsock.ListenAny(0, nil)
+	vsutil.SkipDeviceError(t, err)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	// The Listener reports the wildcard address.
+	laddr := l.Addr().(*vsock.Addr)
+	if laddr.ContextID != unix.VMADDR_CID_ANY {
+		t.Fatalf("unexpected listener context ID: %d", laddr.ContextID)
+	}
+
+	c, err := vsock.Dial(vsock.Local, laddr.Port, nil)
+	if err != nil {
+		t.Skipf("skipping, failed to dial local listener: %v", err)
+	}
+	defer c.Close()
+
+	ac, err := l.AcceptVsock()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer ac.Close()
+
+	// However, the accepted Conn reports the concrete address the client
+	// dialed.
+	want := &vsock.Addr{ContextID: vsock.Local, Port: laddr.Port}
+	if diff := cmp.Diff(want, ac.LocalAddr()); diff != "" {
+		t.Fatalf("unexpected accepted local address (-want +got):\n%s", diff)
+	}
+}
+
+func TestIntegrationConnReadFromWriteTo(t *testing.T) {
+	l, done := newListener(t, nil)
+	defer done()
+
+	want := bytes.Repeat([]byte("vsock"), 1<<16)
+
+	src, err := os.CreateTemp(t.TempDir(), "src")
+	if err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+	defer src.Close()
+
+	if _, err := src.Write(want); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek source file: %v", err)
+	}
+
+	dst, err := os.CreateTemp(t.TempDir(), "dst")
+	if err != nil {
+		t.Fatalf("failed to create destination file: %v", err)
+	}
+	defer dst.Close()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		c, err := l.AcceptVsock()
+		if err != nil {
+			return fmt.Errorf("failed to accept: %v", err)
+		}
+		defer c.Close()
+
+		// Use io.Copy to verify that WriteTo is invoked.
+		if _, err := io.Copy(dst, c); err != nil {
+			return fmt.Errorf("failed to copy to file: %v", err)
+		}
+
+		return nil
+	})
+
+	addr := l.Addr().(*vsock.Addr)
+	c, err := vsock.Dial(addr.ContextID, addr.Port, nil)
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+
+	n, err := c.ReadFrom(src)
+	if err != nil {
+		t.Fatalf("failed to copy from file: %v", err)
+	}
+	if n != int64(len(want)) {
+		t.Fatalf("unexpected number of bytes copied: %d", n)
+	}
+	_ = c.Close()
+
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to wait for listener goroutine: %v", err)
+	}
+
+	got, err := os.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatalf("failed to read destination file: %v", err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Fatalf("unexpected destination file contents: %d bytes", len(got))
+	}
+}
+
+func TestIntegrationDialerZeroCopy(t *testing.T) {
+	errControl := errors.New("control error")
+
+	d := &vsock.Dialer{
+		Config: &vsock.Config{ZeroCopy: true},
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var (
+				v    int
+				verr error
+			)
+			err := c.Control(func(fd uintptr) {
+				v, verr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ZEROCOPY)
+			})
+			if err != nil {
+				return err
+			}
+			if verr != nil {
+				return verr
+			}
+
+			// Older kernels don't support zerocopy for VM sockets and leave
+			// the option unset rather than failing the dial.
+			if v != 1 {
+				t.Skip("skipping, kernel does not support zerocopy VM sockets")
+			}
+
+			return errControl
+		},
+	}
+
+	_, err := d.DialVsock(context.Background(), vsock.Local, 1024)
+	vsutil.SkipDeviceError(t, err)
+
+	if !errors.Is(err, errControl) {
+		t.Fatalf("expected control error, but got: %v", err)
+	}
+}
+
+func TestIntegrationConnWriteZeroCopy(t *testing.T) {
+	cfg := &vsock.Config{ZeroCopy: true}
+
+	l, done := newListener(t, cfg)
+	defer done()
+
+	want := bytes.Repeat([]byte("vsock"), 1<<16)
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		c, err := l.AcceptVsock()
+		if err != nil {
+			return fmt.Errorf("failed to accept: %v", err)
+		}
+		defer c.Close()
+
+		for range 2 {
+			if _, err := c.WriteZeroCopy(want); err != nil {
+				return fmt.Errorf("failed to write: %v", err)
+			}
+		}
+
+		return nil
+	})
+
+	addr := l.Addr().(*vsock.Addr)
+	c, err := vsock.Dial(addr.ContextID, addr.Port, cfg)
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+	defer c.Close()
+
+	got, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to wait for listener goroutine: %v", err)
+	}
+
+	if !bytes.Equal(bytes.Repeat(want, 2), got) {
+		t.Fatalf("unexpected data: %d bytes", len(got))
+	}
+}
+
+func TestIntegrationFileConnOK(t *testing.T) {
+	l, done := newListener(t, nil)
+	defer done()
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		c, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("failed to accept: %v", err)
+		}
+		defer c.Close()
+
+		_, err = io.Copy(c, c)
+		return err
+	})
+
+	addr := l.Addr().(*vsock.Addr)
+	c, err := vsock.Dial(addr.ContextID, addr.Port, nil)
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+
+	f, err := c.File()
+	if err != nil {
+		t.Fatalf("failed to get conn file: %v", err)
+	}
+
+	fc, err := vsock.FileConn(f)
+	if err != nil {
+		t.Fatalf("failed to open file conn: %v", err)
+	}
+
+	// Neither the original connection nor the file are needed after creating
+	// the duplicate connection.
+	_ = c.Close()
+	_ = f.Close()
+
+	if diff := cmp.Diff(c.LocalAddr(), fc.LocalAddr()); diff != "" {
+		t.Fatalf("unexpected local address (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(c.RemoteAddr(), fc.RemoteAddr()); diff != "" {
+		t.Fatalf("unexpected remote address (-want +got):\n%s", diff)
+	}
+
+	want := []byte("hello world")
+	if _, err := fc.Write(want); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(fc, got); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected echoed data (-want +got):\n%s", diff)
+	}
+
+	if err := fc.Close(); err != nil {
+		t.Fatalf("failed to close file conn: %v", err)
+	}
+
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to wait for listener goroutine: %v", err)
+	}
+}
+
+func TestIntegrationFileConnInvalid(t *testing.T) {
+	// Create a connected pair of UNIX sockets so we can verify the library
+	// rejects the socket for having the wrong address family.
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("failed to open socket pair: %v", err)
+	}
+	defer unix.Close(fds[1])
+
+	f := os.NewFile(uintptr(fds[0]), "unix-conn")
+	defer f.Close()
+
+	_, got := vsock.FileConn(f)
+
+	want := &net.OpError{
+		Op:  "file",
+		Net: "vsock",
+		Err: os.NewSyscallError("file", unix.EINVAL),
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+}
+
+func TestIntegrationTransportKernel(t *testing.T) {
+	// newListener skips the test when Local binds are unsupported.
+	l, done := newListener(t, nil)
+	defer done()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			panicf("failed to accept: %v", err)
+		}
+		defer c.Close()
+
+		_, _ = io.WriteString(c, "hello")
+	}()
+
+	var tr vsock.Transport = &vsock.Kernel{}
+
+	addr := l.Addr().(*vsock.Addr)
+	c, err := tr.Dial(context.Background(), addr.ContextID, addr.Port)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if _, ok := c.(*vsock.Conn); !ok {
+		t.Fatalf("expected *vsock.Conn, but got: %T", c)
+	}
+	if diff := cmp.Diff(addr, c.RemoteAddr()); diff != "" {
+		t.Fatalf("unexpected remote address (-want +got):\n%s", diff)
+	}
+
+	b, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(b)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+
+	tl, err := tr.Listen(context.Background(), vsock.Local, 0)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer tl.Close()
+
+	if _, ok := tl.(*vsock.Listener); !ok {
+		t.Fatalf("expected *vsock.Listener, but got: %T", tl)
+	}
+}
+
 func isBrokenPipe(err error) bool {
 	if err == nil {
 		return false
@@ -364,6 +1208,84 @@ func TestIntegrationNettestTestConn(t *testing.T) {
 
 var cidRe = regexp.MustCompile(`\S+\((\d+)\)`)
 
+func TestIntegrationConformance(t *testing.T) {
+	vsutil.SkipHostIntegration(t)
+
+	// newListener skips the test when Local binds are unsupported.
+	_, done := newListener(t, nil)
+	done()
+
+	vsocktest.RunConformance(t, &vsock.Kernel{})
+}
+
+func TestHybridConformance(t *testing.T) {
+	// No VM sockets device is needed: a fake virtual machine monitor bridges
+	// the hybrid vsock UNIX socket to a guest on an in-memory network.
+	n := vsocktest.NewNetwork(nil)
+	host, guest := n.Transport(vsock.Host), n.Transport(3)
+
+	path := filepath.Join(t.TempDir(), "vsock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go bridgeHybrid(c.(*net.UnixConn), host, 3)
+		}
+	}()
+
+	vsocktest.RunConformancePair(t, &vsock.Hybrid{Path: path, GuestContextID: 3}, guest)
+}
+
+// bridgeHybrid performs the monitor side of the hybrid vsock handshake on uc,
+// and then copies data between uc and a connection dialed to cid using tr.
+func bridgeHybrid(uc *net.UnixConn, tr vsock.Transport, cid uint32) {
+	defer uc.Close()
+
+	// The client waits for the response before sending any data, so buffering
+	// the request is safe.
+	line, err := bufio.NewReader(uc).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	var port uint32
+	if _, err := fmt.Sscanf(line, "CONNECT %d\n", &port); err != nil {
+		return
+	}
+
+	// Closing uc without a response refuses the connection.
+	vc, err := tr.Dial(context.Background(), cid, port)
+	if err != nil {
+		return
+	}
+	defer vc.Close()
+
+	if _, err := fmt.Fprintf(uc, "OK %d\n", vc.LocalAddr().(*vsock.Addr).Port); err != nil {
+		return
+	}
+
+	// Forward half-closes in each direction.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.Copy(vc, uc)
+		_ = vc.(*vsocktest.Conn).CloseWrite()
+	}()
+
+	_, _ = io.Copy(uc, vc)
+	_ = uc.CloseWrite()
+	<-done
+}
+
 func TestIntegrationNettestTestListener(t *testing.T) {
 	vsutil.SkipHostIntegration(t)
 
@@ -412,7 +1334,7 @@ func TestIntegrationNettestTestListener(t *testing.T) {
 	// nettest.TestListener(t, mos)
 }
 
-func newListener(t *testing.T) (*vsock.Listener, func()) {
+func newListener(t *testing.T, cfg *vsock.Config) (*vsock.Listener, func()) {
 	t.Helper()
 
 	timer := time.AfterFunc(10*time.Second, func() {
@@ -421,7 +1343,7 @@ func newListener(t *testing.T) (*vsock.Listener, func()) {
 
 	// Bind to Local for all integration tests to avoid the need to run a
 	// hypervisor and VM setup.
-	l, err := vsock.ListenContextID(vsock.Local, 0, nil)
+	l, err := vsock.ListenContextID(vsock.Local, 0, cfg)
 	if err != nil {
 		vsutil.SkipDeviceError(t, err)
 
@@ -437,7 +1359,7 @@ func newListener(t *testing.T) (*vsock.Listener, func()) {
 		}
 
 		switch serr.Err {
-		case unix.EADDRNOTAVAIL:
+		case unix.EADDRNOTAVAIL, unix.ESOCKTNOSUPPORT:
 			skipOldKernel(t)
 		default:
 			t.Fatalf("unexpected vsock listener system call error: %v", err)
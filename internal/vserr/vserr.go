@@ -0,0 +1,99 @@
+// Package vserr provides the error handling shared by package vsock and its
+// subpackages, so that their errors have the same shape.
+package vserr
+
+import (
+	"errors"
+	"net"
+)
+
+// Network is the vsock network reported in net.OpError.
+const Network = "vsock"
+
+// Operation names which may be returned in net.OpError.
+const (
+	OpAccept      = "accept"
+	OpClose       = "close"
+	OpDial        = "dial"
+	OpFile        = "file"
+	OpGet         = "get"
+	OpListen      = "listen"
+	OpRawControl  = "raw-control"
+	OpRawRead     = "raw-read"
+	OpRawWrite    = "raw-write"
+	OpRead        = "read"
+	OpReadFrom    = "readfrom"
+	OpSet         = "set"
+	OpSyscallConn = "syscall-conn"
+	OpWrite       = "write"
+	OpWriteTo     = "writeto"
+)
+
+// OpError produces a net.OpError for op which wraps err, setting its source and
+// destination from the local and remote addresses as appropriate for op. As a
+// convenience, OpError returns nil if the input error is nil.
+func OpError(op string, err error, local, remote net.Addr) error {
+	if err == nil {
+		return nil
+	}
+
+	// Determine source and addr using the rules defined by net.OpError's
+	// documentation: https://golang.org/pkg/net/#OpError.
+	var source, addr net.Addr
+	switch op {
+	case OpClose, OpDial, OpFile, OpRawRead, OpRawWrite, OpRead, OpReadFrom, OpWrite, OpWriteTo:
+		if local != nil {
+			source = local
+		}
+		if remote != nil {
+			addr = remote
+		}
+	case OpAccept, OpGet, OpListen, OpRawControl, OpSet, OpSyscallConn:
+		if local != nil {
+			addr = local
+		}
+	}
+
+	return &net.OpError{
+		Op:     op,
+		Net:    Network,
+		Source: source,
+		Addr:   addr,
+		Err:    err,
+	}
+}
+
+// WithSentinel wraps err so that it also matches sentinel using errors.Is. If
+// sentinel is nil, err is returned unmodified.
+func WithSentinel(err, sentinel error) error {
+	if sentinel == nil {
+		return err
+	}
+
+	return &sentinelError{
+		err:      err,
+		sentinel: sentinel,
+	}
+}
+
+// A sentinelError associates an error with a sentinel error so that both can be
+// matched using errors.Is and errors.As. Its message is that of the underlying
+// error.
+type sentinelError struct {
+	err, sentinel error
+}
+
+func (e *sentinelError) Error() string   { return e.err.Error() }
+func (e *sentinelError) Unwrap() []error { return []error{e.err, e.sentinel} }
+
+// Timeout and Temporary report the values of the underlying error so that the
+// methods of net.OpError continue to work.
+func (e *sentinelError) Timeout() bool {
+	var t interface{ Timeout() bool }
+	return errors.As(e.err, &t) && t.Timeout()
+}
+
+func (e *sentinelError) Temporary() bool {
+	var t interface{ Temporary() bool }
+	return errors.As(e.err, &t) && t.Temporary()
+}
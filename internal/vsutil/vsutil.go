@@ -2,8 +2,8 @@
 package vsutil
 
 import (
-	"net"
-	"os"
+	"errors"
+	"io/fs"
 	"testing"
 
 	"github.com/mdlayher/vsock"
@@ -30,16 +30,10 @@ func IsHypervisor(t *testing.T) bool {
 func SkipDeviceError(t *testing.T, err error) {
 	t.Helper()
 
-	// Unwrap net.OpError if needed.
-	// TODO(mdlayher): errors.Unwrap in Go 1.13.
-	if nerr, ok := err.(*net.OpError); ok {
-		err = nerr.Err
-	}
-
-	if os.IsNotExist(err) {
+	if errors.Is(err, vsock.ErrNoDevice) || errors.Is(err, fs.ErrNotExist) {
 		t.Skipf("skipping, vsock device does not exist (try: 'modprobe vhost_vsock'): %v", err)
 	}
-	if os.IsPermission(err) {
+	if errors.Is(err, vsock.ErrPermission) || errors.Is(err, fs.ErrPermission) {
 		t.Skipf("skipping, permission denied (try: 'chmod 666 /dev/vsock'): %v", err)
 	}
 }
@@ -6,44 +6,98 @@ import (
 	"context"
 	"net"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/mdlayher/socket"
 	"golang.org/x/sys/unix"
 )
 
-var _ net.Listener = &listener{}
-
-// A listener is the net.Listener implementation for connection-oriented
+// A listener is the internal implementation of Listener for connection-oriented
 // VM sockets.
 type listener struct {
 	c    *socket.Conn
 	addr *Addr
+
+	// zeroCopy enables SO_ZEROCOPY on accepted Conns.
+	zeroCopy bool
+
+	// path is the UNIX socket path of a hybrid vsock listener, which is
+	// removed when the listener is closed. Empty for VM sockets listeners.
+	path string
+
+	// guest is the context ID of the guest which connects to a hybrid vsock
+	// listener, reported as the remote address of accepted Conns.
+	guest uint32
 }
 
-// Addr and Close implement the net.Listener interface for listener.
+// Addr implements the net.Listener interface for listener.
 func (l *listener) Addr() net.Addr                { return l.addr }
-func (l *listener) Close() error                  { return l.c.Close() }
+func (l *listener) File() (*os.File, error)       { return dupFile(l.c, l.addr.fileName()) }
 func (l *listener) SetDeadline(t time.Time) error { return l.c.SetDeadline(t) }
 
+func (l *listener) SyscallConn() (syscall.RawConn, error) { return l.c.SyscallConn() }
+
+// Close implements the net.Listener interface for listener.
+func (l *listener) Close() error {
+	if err := l.c.Close(); err != nil {
+		return err
+	}
+
+	if l.path != "" {
+		// Like net.UnixListener, clean up the socket file once the listener
+		// is closed.
+		_ = os.Remove(l.path)
+	}
+
+	return nil
+}
+
 // Accept accepts a single connection from the listener, and sets up
-// a net.Conn backed by conn.
-func (l *listener) Accept() (net.Conn, error) {
+// a *Conn backed by conn.
+func (l *listener) Accept() (*Conn, error) {
 	c, rsa, err := l.c.Accept(context.Background(), 0)
 	if err != nil {
 		return nil, err
 	}
 
-	savm := rsa.(*unix.SockaddrVM)
-	remote := &Addr{
-		ContextID: savm.CID,
-		Port:      savm.Port,
+	if l.path != "" {
+		// The monitor does not convey the guest's port for hybrid vsock
+		// connections.
+		return &Conn{
+			c:      c,
+			local:  l.addr,
+			remote: &Addr{ContextID: l.guest, Port: portAny},
+			hybrid: true,
+		}, nil
+	}
+
+	local := l.addr
+	if local.ContextID == cidAny {
+		// The listener is bound to the wildcard context ID, so determine the
+		// concrete context ID the peer actually reached.
+		lsa, err := c.Getsockname()
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+
+		local = newAddr(lsa.(*unix.SockaddrVM))
+	}
+
+	var zc *zeroCopy
+	if l.zeroCopy {
+		if zc, err = enableZeroCopy(c); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
 	}
 
 	return &Conn{
 		c:      c,
-		local:  l.addr,
-		remote: remote,
+		local:  local,
+		remote: newAddr(rsa.(*unix.SockaddrVM)),
+		zc:     zc,
 	}, nil
 }
 
@@ -51,11 +105,19 @@ func (l *listener) Accept() (net.Conn, error) {
 const name = "vsock"
 
 // listen is the entry point for Listen on Linux.
-func listen(cid, port uint32, _ *Config) (*Listener, error) {
-	// TODO(mdlayher): Config default nil check and initialize. Pass options to
-	// socket.Config where necessary.
+func listen(ctx context.Context, cid, port uint32, lc *ListenConfig) (*Listener, error) {
+	// Creating a Listener does not block, so the context is only checked for
+	// cancelation before any system calls are made.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cfg := lc.Config
+	if cfg == nil {
+		cfg = &Config{}
+	}
 
-	c, err := socket.Socket(unix.AF_VSOCK, unix.SOCK_STREAM, 0, name, nil)
+	c, err := newSocket(sotype(cfg), cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +125,25 @@ func listen(cid, port uint32, _ *Config) (*Listener, error) {
 	// Be sure to close the Conn if any of the system calls fail before we
 	// return the Conn to the caller.
 
+	if err := setConfig(c, cfg); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	if lc.Control != nil {
+		rc, err := c.SyscallConn()
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+
+		addr := &Addr{ContextID: cid, Port: port}
+		if err := lc.Control(network, addr.String(), rc); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
 	if port == 0 {
 		port = unix.VMADDR_PORT_ANY
 	}
@@ -72,7 +153,12 @@ func listen(cid, port uint32, _ *Config) (*Listener, error) {
 		return nil, err
 	}
 
-	if err := c.Listen(unix.SOMAXCONN); err != nil {
+	backlog := lc.Backlog
+	if backlog == 0 {
+		backlog = unix.SOMAXCONN
+	}
+
+	if err := c.Listen(backlog); err != nil {
 		_ = c.Close()
 		return nil, err
 	}
@@ -82,6 +168,7 @@ func listen(cid, port uint32, _ *Config) (*Listener, error) {
 		_ = c.Close()
 		return nil, err
 	}
+	l.l.zeroCopy = cfg.ZeroCopy
 
 	return l, nil
 }
@@ -118,15 +205,10 @@ func newListener(c *socket.Conn) (*Listener, error) {
 		return nil, os.NewSyscallError("listen", unix.EINVAL)
 	}
 
-	addr := &Addr{
-		ContextID: lsavm.CID,
-		Port:      lsavm.Port,
-	}
-
 	return &Listener{
 		l: &listener{
 			c:    c,
-			addr: addr,
+			addr: newAddr(lsavm),
 		},
 	}, nil
 }
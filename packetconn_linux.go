@@ -0,0 +1,73 @@
+//go:build linux
+
+package vsock
+
+import (
+	"context"
+
+	"github.com/mdlayher/socket"
+	"golang.org/x/sys/unix"
+)
+
+// A packetConn is the net.PacketConn implementation for connectionless VM
+// sockets. The embedded socket.Conn implements the methods which do not deal
+// with addresses.
+type packetConn struct {
+	*socket.Conn
+}
+
+// ReadFrom reads a single datagram and returns the address of its sender.
+func (c *packetConn) ReadFrom(b []byte) (int, *Addr, error) {
+	n, sa, err := c.Recvfrom(context.Background(), b, 0)
+	if err != nil {
+		return n, nil, err
+	}
+
+	return n, newAddr(sa.(*unix.SockaddrVM)), nil
+}
+
+// WriteTo writes a single datagram to addr.
+func (c *packetConn) WriteTo(b []byte, addr *Addr) (int, error) {
+	if err := c.Sendto(context.Background(), b, 0, sockaddr(addr)); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// listenPacket is the entry point for ListenPacket on Linux.
+func listenPacket(cid, port uint32, cfg *Config) (*PacketConn, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	// Datagram sockets don't support the VM sockets socket options, so only
+	// the network namespace applies.
+	c, err := newSocket(unix.SOCK_DGRAM, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Be sure to close the Conn if any of the system calls fail before we
+	// return the Conn to the caller.
+
+	if port == 0 {
+		port = unix.VMADDR_PORT_ANY
+	}
+
+	if err := c.Bind(&unix.SockaddrVM{CID: cid, Port: port}); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	lsa, err := c.Getsockname()
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return &PacketConn{
+		c:     &packetConn{Conn: c},
+		local: newAddr(lsa.(*unix.SockaddrVM)),
+	}, nil
+}
@@ -0,0 +1,200 @@
+package vsock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// resetPollInterval is how often WatchTransportReset checks for a change in
+// this machine's context ID.
+const resetPollInterval = 1 * time.Second
+
+// resetBurstWindow is how long WatchTransportReset waits after a connection
+// failure for other connections to fail as part of the same burst.
+const resetBurstWindow = 100 * time.Millisecond
+
+// A TransportReset describes a reset of this machine's VM sockets transport,
+// which occurs when a virtual machine is live migrated or restored from a
+// snapshot. All established connections fail with ErrTransportReset when the
+// transport is reset.
+type TransportReset struct {
+	// Time is the time at which the reset was detected.
+	Time time.Time
+
+	// ContextID is this machine's context ID after the reset, and
+	// PreviousContextID is the context ID before the reset. They are equal if
+	// the reset was detected by connection failures and the context ID did
+	// not change.
+	ContextID, PreviousContextID uint32
+}
+
+// WatchTransportReset returns a channel which receives a TransportReset each
+// time a reset of this machine's VM sockets transport is detected, until ctx
+// is canceled, at which point the channel is closed.
+//
+// The kernel does not notify userspace of transport resets directly, so they
+// are inferred by periodically checking for a change in the context ID
+// reported by ContextID, and from connections in this process failing with
+// ErrTransportReset. The kernel reports the same error when a single peer
+// resets its connection, so a failure only indicates a transport reset if the
+// context ID changed or if more than one connection failed in the same burst.
+// Each burst produces a single TransportReset. Hybrid vsock connections are
+// not considered.
+//
+// This is typically used by agents running in a virtual machine which must
+// register with the host again after a migration.
+//
+// If the context ID of this machine cannot be determined, an error is
+// returned.
+func WatchTransportReset(ctx context.Context) (<-chan TransportReset, error) {
+	return watchTransportReset(ctx, ContextID, resetPollInterval, resetBurstWindow)
+}
+
+// watchTransportReset implements WatchTransportReset with the ability to
+// replace the ContextID function, poll interval, and burst window for tests.
+func watchTransportReset(
+	ctx context.Context,
+	contextID func() (uint32, error),
+	interval, window time.Duration,
+) (<-chan TransportReset, error) {
+	prev, err := contextID()
+	if err != nil {
+		return nil, err
+	}
+
+	sub, unsubscribe := resets.subscribe()
+	out := make(chan TransportReset)
+
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			var failed int
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.c:
+				// Wait for the remainder of the burst so that it produces a
+				// single TransportReset.
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(window):
+				}
+
+				failed = sub.take()
+			case <-t.C:
+			}
+
+			// The context ID may be briefly unavailable while the transport
+			// is reset, so errors are ignored and retried on the next tick.
+			cid, err := contextID()
+			if err != nil {
+				if failed < 2 {
+					continue
+				}
+
+				cid = prev
+			}
+
+			// A lone connection failure with no change in context ID is most
+			// likely a reset by the peer.
+			if cid == prev && failed < 2 {
+				continue
+			}
+
+			r := TransportReset{
+				Time:              time.Now(),
+				ContextID:         cid,
+				PreviousContextID: prev,
+			}
+			prev = cid
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- r:
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// resets notifies WatchTransportReset of connections which failed with
+// ErrTransportReset.
+var resets = &resetNotifier{}
+
+// A resetNotifier fans out connection failure notifications to subscribers.
+type resetNotifier struct {
+	mu   sync.Mutex
+	subs map[*resetSubscriber]struct{}
+}
+
+// A resetSubscriber accumulates the connections which failed since it was last
+// drained by take.
+type resetSubscriber struct {
+	// c is signaled when a connection fails. It buffers a single notification
+	// so that notify never blocks.
+	c chan struct{}
+
+	mu    sync.Mutex
+	conns map[*Conn]struct{}
+}
+
+// take returns the number of distinct connections which failed since the last
+// call to take.
+func (s *resetSubscriber) take() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.conns)
+	clear(s.conns)
+	return n
+}
+
+// subscribe returns a subscriber which is signaled when notify is called, and a
+// function to unsubscribe.
+func (n *resetNotifier) subscribe() (*resetSubscriber, func()) {
+	s := &resetSubscriber{
+		c:     make(chan struct{}, 1),
+		conns: make(map[*Conn]struct{}),
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.subs == nil {
+		n.subs = make(map[*resetSubscriber]struct{})
+	}
+	n.subs[s] = struct{}{}
+
+	return s, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.subs, s)
+	}
+}
+
+// notify records the failure of c and signals all subscribers without
+// blocking.
+func (n *resetNotifier) notify(c *Conn) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for s := range n.subs {
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		select {
+		case s.c <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package vsock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestWatchTransportResetContextIDChange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The context ID changes after a few polls, and is briefly unavailable.
+	var (
+		mu   sync.Mutex
+		cids = []uint32{3, 3, 0, 3, 4}
+	)
+	contextID := func() (uint32, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		cid := cids[0]
+		if len(cids) > 1 {
+			cids = cids[1:]
+		}
+		if cid == 0 {
+			return 0, errors.New("transport unavailable")
+		}
+
+		return cid, nil
+	}
+
+	resetC, err := watchTransportReset(ctx, contextID, time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	want := TransportReset{ContextID: 4, PreviousContextID: 3}
+	if diff := cmp.Diff(want, <-resetC, cmpopts.IgnoreFields(TransportReset{}, "Time")); diff != "" {
+		t.Fatalf("unexpected reset (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	for range resetC {
+		// Wait for the channel to be closed.
+	}
+}
+
+func TestWatchTransportResetConnFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	contextID := func() (uint32, error) { return 3, nil }
+
+	// Use a long interval so only the connection failures trigger a reset.
+	resetC, err := watchTransportReset(ctx, contextID, time.Hour, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	// A burst of failures from several connections produces a single reset.
+	conns := []*Conn{{}, {}, {}}
+	for range 10 {
+		for _, c := range conns {
+			resets.notify(c)
+		}
+	}
+
+	want := TransportReset{ContextID: 3, PreviousContextID: 3}
+	if diff := cmp.Diff(want, <-resetC, cmpopts.IgnoreFields(TransportReset{}, "Time")); diff != "" {
+		t.Fatalf("unexpected reset (-want +got):\n%s", diff)
+	}
+
+	// Allow any leftover notifications to be processed before canceling.
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	var n int
+	for range resetC {
+		n++
+	}
+	if n != 0 {
+		t.Fatalf("expected failures to coalesce, but got %d more resets", n)
+	}
+}
+
+func TestWatchTransportResetLoneConnFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	contextID := func() (uint32, error) { return 3, nil }
+
+	resetC, err := watchTransportReset(ctx, contextID, time.Hour, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	// Repeated failures of a single connection with no change in context ID
+	// are most likely caused by the peer, so no reset is reported.
+	c := &Conn{}
+	for range 10 {
+		resets.notify(c)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	var n int
+	for range resetC {
+		n++
+	}
+	if n != 0 {
+		t.Fatalf("expected no resets, but got %d", n)
+	}
+}
+
+func TestWatchTransportResetError(t *testing.T) {
+	errContextID := errors.New("no context ID")
+
+	_, err := watchTransportReset(context.Background(), func() (uint32, error) {
+		return 0, errContextID
+	}, time.Hour, time.Hour)
+	if !errors.Is(err, errContextID) {
+		t.Fatalf("expected context ID error, but got: %v", err)
+	}
+}
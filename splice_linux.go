@@ -0,0 +1,349 @@
+//go:build linux
+
+package vsock
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSpliceSize is the maximum number of bytes moved by a single call to
+// splice(2) or sendfile(2), and the size requested for splice pipes.
+const maxSpliceSize = 1 << 20
+
+// readFrom is the entry point for Conn.ReadFrom on Linux. It reports whether
+// it handled the copy; if not, the caller should fall back to a generic copy of
+// the remaining data, in addition to the n bytes which were already copied.
+func readFrom(c *conn, r io.Reader) (int64, bool, error) {
+	remain := int64(math.MaxInt64)
+	lr, ok := r.(*io.LimitedReader)
+	if ok {
+		remain, r = lr.N, lr.R
+		if remain <= 0 {
+			return 0, true, nil
+		}
+	}
+
+	src, ok := copyRawConn(r)
+	if !ok {
+		return 0, false, nil
+	}
+
+	regular, pollable, _ := fileKind(src)
+	if !regular && !pollable {
+		// The runtime poller cannot wait for src to become readable, so a
+		// nonblocking splice(2) would fail rather than wait.
+		return 0, false, nil
+	}
+
+	dst, err := c.SyscallConn()
+	if err != nil {
+		return 0, true, err
+	}
+
+	var (
+		n       int64
+		handled bool
+	)
+
+	if regular {
+		// Regular files can be sent directly to the socket.
+		n, handled, err = sendfile(dst, src, remain)
+	} else {
+		n, handled, err = splice(dst, src, remain, unix.Splice)
+	}
+
+	if lr != nil {
+		lr.N -= n
+	}
+
+	return n, handled, err
+}
+
+// writeTo is the entry point for Conn.WriteTo on Linux. It reports whether it
+// handled the copy; if not, the caller should fall back to a generic copy of
+// the remaining data, in addition to the n bytes which were already copied.
+func writeTo(c *conn, w io.Writer) (int64, bool, error) {
+	dst, ok := copyRawConn(w)
+	if !ok {
+		return 0, false, nil
+	}
+
+	regular, pollable, appendOnly := fileKind(dst)
+	switch {
+	case appendOnly:
+		// splice(2) does not support files opened with O_APPEND.
+		return 0, false, nil
+	case !regular && !pollable:
+		// The runtime poller cannot wait for dst to become writable.
+		return 0, false, nil
+	}
+
+	src, err := c.SyscallConn()
+	if err != nil {
+		return 0, true, err
+	}
+
+	return splice(dst, src, math.MaxInt64, unix.Splice)
+}
+
+// copyRawConn returns the syscall.RawConn for the file descriptor behind v, if any.
+// Besides *Conn and *os.File, this finds the file descriptor of the wrappers
+// around an *os.File which io.Copy passes to ReadFrom and WriteTo.
+func copyRawConn(v any) (syscall.RawConn, bool) {
+	sc, ok := v.(syscall.Conn)
+	if !ok {
+		return nil, false
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, false
+	}
+
+	return rc, true
+}
+
+// fileKind reports whether the file descriptor behind rc is a regular file,
+// whether it is in nonblocking mode and can therefore be waited on by the
+// runtime poller, and whether it was opened with O_APPEND.
+func fileKind(rc syscall.RawConn) (regular, pollable, appendOnly bool) {
+	var (
+		st    unix.Stat_t
+		flags int
+	)
+
+	_ = rc.Control(func(fd uintptr) {
+		if err := unix.Fstat(int(fd), &st); err == nil {
+			regular = st.Mode&unix.S_IFMT == unix.S_IFREG
+		}
+
+		flags, _ = unix.FcntlInt(fd, unix.F_GETFL, 0)
+	})
+
+	return regular, flags&unix.O_NONBLOCK != 0, flags&unix.O_APPEND != 0
+}
+
+// sendfile copies up to remain bytes from the regular file src to the socket
+// dst using sendfile(2).
+func sendfile(dst, src syscall.RawConn, remain int64) (int64, bool, error) {
+	var (
+		written int64
+		serr    error
+	)
+
+	cerr := src.Control(func(sfd uintptr) {
+		werr := dst.Write(func(dfd uintptr) bool {
+			for remain > 0 {
+				n, err := unix.Sendfile(int(dfd), int(sfd), nil, int(min(remain, maxSpliceSize)))
+				if n > 0 {
+					written += int64(n)
+					remain -= int64(n)
+				}
+
+				switch {
+				case errors.Is(err, unix.EINTR):
+					continue
+				case errors.Is(err, unix.EAGAIN):
+					// Wait for the socket to become writable.
+					return false
+				case err != nil:
+					serr = os.NewSyscallError("sendfile", err)
+					return true
+				case n == 0:
+					// End of file.
+					return true
+				}
+			}
+
+			return true
+		})
+		if serr == nil {
+			serr = werr
+		}
+	})
+	if serr == nil {
+		serr = cerr
+	}
+
+	if isUnsupported(serr) {
+		// sendfile(2) only consumes the data it sends, so the caller can fall
+		// back to a generic copy of the remainder.
+		return written, false, nil
+	}
+
+	return written, true, serr
+}
+
+// A spliceFunc is a function with the signature of unix.Splice, which may be
+// replaced to inject failures in tests.
+type spliceFunc func(rfd int, roff *int64, wfd int, woff *int64, len int, flags int) (int64, error)
+
+// splice copies up to remain bytes from src to dst by splicing the data through
+// an intermediate pipe using fn, which is normally unix.Splice.
+func splice(dst, src syscall.RawConn, remain int64, fn spliceFunc) (int64, bool, error) {
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		return 0, false, nil
+	}
+	defer func() {
+		_ = unix.Close(p[0])
+		_ = unix.Close(p[1])
+	}()
+
+	// A larger pipe allows more data to move with each call, but the default
+	// size works if the limit does not permit this.
+	_, _ = unix.FcntlInt(uintptr(p[1]), unix.F_SETPIPE_SZ, maxSpliceSize)
+
+	const flags = unix.SPLICE_F_MOVE | unix.SPLICE_F_NONBLOCK
+
+	var written int64
+	for remain > 0 {
+		// Move data from src into the pipe.
+		var (
+			inPipe int
+			serr   error
+		)
+
+		rerr := src.Read(func(sfd uintptr) bool {
+			for {
+				n, err := fn(int(sfd), nil, p[1], nil, int(min(remain, maxSpliceSize)), flags)
+				switch {
+				case errors.Is(err, unix.EINTR):
+					continue
+				case errors.Is(err, unix.EAGAIN):
+					return false
+				case err != nil:
+					serr = os.NewSyscallError("splice", err)
+					return true
+				}
+
+				inPipe = int(n)
+				return true
+			}
+		})
+		if serr == nil {
+			serr = rerr
+		}
+		if serr != nil {
+			if isUnsupported(serr) {
+				// The pipe is empty, so no data was lost and the caller can fall
+				// back to a generic copy of the remainder.
+				return written, false, nil
+			}
+
+			return written, true, serr
+		}
+		if inPipe == 0 {
+			// End of file.
+			break
+		}
+
+		// Drain the pipe into dst.
+		werr := dst.Write(func(dfd uintptr) bool {
+			for inPipe > 0 {
+				n, err := fn(p[0], nil, int(dfd), nil, inPipe, flags)
+				if n > 0 {
+					inPipe -= int(n)
+					written += n
+					remain -= n
+				}
+
+				switch {
+				case errors.Is(err, unix.EINTR):
+					continue
+				case errors.Is(err, unix.EAGAIN):
+					return false
+				case err != nil:
+					serr = os.NewSyscallError("splice", err)
+					return true
+				}
+			}
+
+			return true
+		})
+		if serr == nil {
+			serr = werr
+		}
+		if serr != nil {
+			if !isUnsupported(serr) {
+				return written, true, serr
+			}
+
+			// The data in the pipe was already consumed from src, so it must
+			// be written to dst before the caller falls back to a generic copy
+			// of the remainder.
+			n, err := drainPipe(dst, p[0], inPipe)
+			written += n
+			if err != nil {
+				return written, true, err
+			}
+
+			return written, false, nil
+		}
+	}
+
+	return written, true, nil
+}
+
+// drainPipe writes the n bytes held by the pipe read end p to dst using
+// read(2) and write(2), for a dst which does not support splice(2).
+func drainPipe(dst syscall.RawConn, p, n int) (int64, error) {
+	// The pipe already holds all n bytes, so reading never blocks.
+	b := make([]byte, n)
+	for off := 0; off < n; {
+		nr, err := unix.Read(p, b[off:])
+		switch {
+		case errors.Is(err, unix.EINTR):
+			continue
+		case err != nil:
+			return 0, os.NewSyscallError("read", err)
+		}
+
+		off += nr
+	}
+
+	var (
+		written int64
+		serr    error
+	)
+
+	werr := dst.Write(func(dfd uintptr) bool {
+		for len(b) > 0 {
+			nw, err := unix.Write(int(dfd), b)
+			if nw > 0 {
+				written += int64(nw)
+				b = b[nw:]
+			}
+
+			switch {
+			case errors.Is(err, unix.EINTR):
+				continue
+			case errors.Is(err, unix.EAGAIN):
+				return false
+			case err != nil:
+				serr = os.NewSyscallError("write", err)
+				return true
+			}
+		}
+
+		return true
+	})
+	if serr == nil {
+		serr = werr
+	}
+
+	return written, serr
+}
+
+// isUnsupported reports whether err indicates that splice(2) or sendfile(2)
+// cannot be used with a file descriptor.
+func isUnsupported(err error) bool {
+	return errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) ||
+		errors.Is(err, unix.EOPNOTSUPP)
+}
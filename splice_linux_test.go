@@ -0,0 +1,430 @@
+package vsock
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/socket"
+	"golang.org/x/sys/unix"
+)
+
+func Test_readFromFile(t *testing.T) {
+	want := bytes.Repeat([]byte("vsock"), 1<<16)
+
+	tests := []struct {
+		name string
+		n    int64
+		open func(t *testing.T) *os.File
+	}{
+		{
+			name: "sendfile",
+			n:    int64(len(want)),
+			open: func(t *testing.T) *os.File {
+				return tempFile(t, want)
+			},
+		},
+		{
+			name: "sendfile limited",
+			n:    100,
+			open: func(t *testing.T) *os.File {
+				return tempFile(t, want)
+			},
+		},
+		{
+			name: "splice",
+			n:    int64(len(want)),
+			open: func(t *testing.T) *os.File {
+				r, w, err := os.Pipe()
+				if err != nil {
+					t.Fatalf("failed to open pipe: %v", err)
+				}
+				t.Cleanup(func() { _ = r.Close() })
+
+				go func() {
+					defer w.Close()
+					_, _ = w.Write(want)
+				}()
+
+				return r
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, peer := socketPair(t)
+
+			// Read the other end of the connection concurrently so the
+			// socket buffer doesn't fill up.
+			done := make(chan []byte)
+			go func() {
+				b, _ := io.ReadAll(peer)
+				done <- b
+			}()
+
+			r := io.Reader(tt.open(t))
+			if tt.n != int64(len(want)) {
+				r = io.LimitReader(r, tt.n)
+			}
+
+			n, handled, err := readFrom(c, r)
+			if err != nil {
+				t.Fatalf("failed to read from: %v", err)
+			}
+			if !handled {
+				t.Fatal("readFrom did not handle the copy")
+			}
+			_ = c.Close()
+
+			if diff := cmp.Diff(tt.n, n); diff != "" {
+				t.Fatalf("unexpected number of bytes (-want +got):\n%s", diff)
+			}
+			// Avoid cmp.Diff for large byte slices.
+			if got := <-done; !bytes.Equal(want[:tt.n], got) {
+				t.Fatalf("unexpected data: %d bytes", len(got))
+			}
+		})
+	}
+}
+
+func Test_readFromUnhandled(t *testing.T) {
+	c, _ := socketPair(t)
+
+	n, handled, err := readFrom(c, bytes.NewReader([]byte("hello")))
+	if n != 0 || handled || err != nil {
+		t.Fatalf("expected unhandled copy, but got: %d, %v, %v", n, handled, err)
+	}
+}
+
+func Test_writeToFile(t *testing.T) {
+	want := bytes.Repeat([]byte("vsock"), 1<<16)
+
+	c, peer := socketPair(t)
+	go func() {
+		defer peer.Close()
+		_, _ = peer.Write(want)
+	}()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "vsock"))
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	n, handled, err := writeTo(c, f)
+	if err != nil {
+		t.Fatalf("failed to write to: %v", err)
+	}
+	if !handled {
+		t.Fatal("writeTo did not handle the copy")
+	}
+	if diff := cmp.Diff(int64(len(want)), n); diff != "" {
+		t.Fatalf("unexpected number of bytes (-want +got):\n%s", diff)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Fatalf("unexpected data: %d bytes", len(got))
+	}
+}
+
+func Test_readFromBlockingPipe(t *testing.T) {
+	// A blocking pipe, such as a shell pipeline on stdin, cannot be waited on
+	// by the runtime poller and must fall back to a generic copy.
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC); err != nil {
+		t.Fatalf("failed to open pipe: %v", err)
+	}
+
+	r := os.NewFile(uintptr(p[0]), "pipe")
+	defer r.Close()
+	w := os.NewFile(uintptr(p[1]), "pipe")
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	_ = w.Close()
+
+	sc, peer := socketPair(t)
+	n, handled, err := readFrom(sc, r)
+	if n != 0 || handled || err != nil {
+		t.Fatalf("expected unhandled copy, but got: %d, %v, %v", n, handled, err)
+	}
+
+	c := &Conn{c: sc}
+	if _, err := io.Copy(c, r); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	_ = c.Close()
+
+	got, err := io.ReadAll(peer)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(got)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnCopyFile(t *testing.T) {
+	want := bytes.Repeat([]byte("vsock"), 1<<16)
+
+	t.Run("ReadFrom", func(t *testing.T) {
+		sc, peer := socketPair(t)
+		c := &Conn{c: sc}
+
+		done := make(chan []byte)
+		go func() {
+			b, _ := io.ReadAll(peer)
+			done <- b
+		}()
+
+		// io.Copy passes a wrapper around the *os.File to ReadFrom.
+		n, err := io.Copy(c, tempFile(t, want))
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		_ = c.CloseWrite()
+
+		if diff := cmp.Diff(int64(len(want)), n); diff != "" {
+			t.Fatalf("unexpected number of bytes (-want +got):\n%s", diff)
+		}
+		if got := <-done; !bytes.Equal(want, got) {
+			t.Fatalf("unexpected data: %d bytes", len(got))
+		}
+
+		// A generic copy would use many writes.
+		stats, err := c.Stats()
+		if err != nil {
+			t.Fatalf("failed to get stats: %v", err)
+		}
+		if diff := cmp.Diff(uint64(1), stats.Writes); diff != "" {
+			t.Fatalf("unexpected number of writes (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("WriteTo", func(t *testing.T) {
+		sc, peer := socketPair(t)
+		c := &Conn{c: sc}
+
+		go func() {
+			defer peer.Close()
+			_, _ = peer.Write(want)
+		}()
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "vsock"))
+		if err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+		defer f.Close()
+
+		n, err := io.Copy(f, c)
+		if err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		if diff := cmp.Diff(int64(len(want)), n); diff != "" {
+			t.Fatalf("unexpected number of bytes (-want +got):\n%s", diff)
+		}
+
+		got, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatalf("failed to read file: %v", err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Fatalf("unexpected data: %d bytes", len(got))
+		}
+
+		stats, err := c.Stats()
+		if err != nil {
+			t.Fatalf("failed to get stats: %v", err)
+		}
+		if diff := cmp.Diff(uint64(1), stats.Reads); diff != "" {
+			t.Fatalf("unexpected number of reads (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestConnCopyConnStats(t *testing.T) {
+	want := bytes.Repeat([]byte("vsock"), 1<<16)
+
+	tests := []struct {
+		name string
+		copy func(dst, src *Conn) (int64, error)
+	}{
+		{
+			name: "ReadFrom",
+			copy: func(dst, src *Conn) (int64, error) {
+				// As used by io.CopyN.
+				return dst.ReadFrom(io.LimitReader(src, int64(len(want))))
+			},
+		},
+		{
+			name: "WriteTo",
+			copy: func(dst, src *Conn) (int64, error) { return src.WriteTo(dst) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ssc, speer := socketPair(t)
+			dsc, dpeer := socketPair(t)
+			src, dst := &Conn{c: ssc}, &Conn{c: dsc}
+
+			go func() {
+				defer speer.Close()
+				_, _ = speer.Write(want)
+			}()
+
+			done := make(chan []byte)
+			go func() {
+				b, _ := io.ReadAll(dpeer)
+				done <- b
+			}()
+
+			n, err := tt.copy(dst, src)
+			if err != nil {
+				t.Fatalf("failed to copy: %v", err)
+			}
+			_ = dst.CloseWrite()
+
+			if diff := cmp.Diff(int64(len(want)), n); diff != "" {
+				t.Fatalf("unexpected number of bytes (-want +got):\n%s", diff)
+			}
+			if got := <-done; !bytes.Equal(want, got) {
+				t.Fatalf("unexpected data: %d bytes", len(got))
+			}
+
+			// Both Conns account for the spliced data.
+			sstats, err := src.Stats()
+			if err != nil {
+				t.Fatalf("failed to get source stats: %v", err)
+			}
+			if diff := cmp.Diff(uint64(len(want)), sstats.BytesRead); diff != "" {
+				t.Fatalf("unexpected source bytes read (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(uint64(1), sstats.Reads); diff != "" {
+				t.Fatalf("unexpected source reads (-want +got):\n%s", diff)
+			}
+
+			dstats, err := dst.Stats()
+			if err != nil {
+				t.Fatalf("failed to get destination stats: %v", err)
+			}
+			if diff := cmp.Diff(uint64(len(want)), dstats.BytesWritten); diff != "" {
+				t.Fatalf("unexpected destination bytes written (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(uint64(1), dstats.Writes); diff != "" {
+				t.Fatalf("unexpected destination writes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_spliceDrainPipe(t *testing.T) {
+	c, peer := socketPair(t)
+	if _, err := peer.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "vsock"))
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	src, err := c.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to open source raw conn: %v", err)
+	}
+	dst, err := f.SyscallConn()
+	if err != nil {
+		t.Fatalf("failed to open destination raw conn: %v", err)
+	}
+
+	// Fill the pipe from the socket, but then fail to splice the pipe to the
+	// file as a destination which does not support splice(2) would.
+	var calls int
+	fn := func(rfd int, roff *int64, wfd int, woff *int64, len int, flags int) (int64, error) {
+		calls++
+		if calls > 1 {
+			return 0, unix.EINVAL
+		}
+
+		return unix.Splice(rfd, roff, wfd, woff, len, flags)
+	}
+
+	n, handled, err := splice(dst, src, math.MaxInt64, fn)
+	if err != nil {
+		t.Fatalf("failed to splice: %v", err)
+	}
+	if handled {
+		t.Fatal("splice handled the copy, but the destination is unsupported")
+	}
+	if diff := cmp.Diff(int64(5), n); diff != "" {
+		t.Fatalf("unexpected number of bytes (-want +got):\n%s", diff)
+	}
+
+	// The data already consumed from the socket must not be lost.
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(got)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+}
+
+// socketPair returns a *conn and an *os.File for either end of a connected
+// pair of UNIX sockets. Although they aren't VM sockets, they are sufficient
+// to exercise the splice(2) and sendfile(2) code paths.
+func socketPair(t *testing.T) (*conn, *os.File) {
+	t.Helper()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("failed to open socket pair: %v", err)
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "unix")
+	defer f.Close()
+
+	c, err := socket.FileConn(f, "unix")
+	if err != nil {
+		t.Fatalf("failed to open conn: %v", err)
+	}
+
+	peer := os.NewFile(uintptr(fds[1]), "unix-peer")
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = peer.Close()
+	})
+
+	return c, peer
+}
+
+// tempFile returns a regular file containing b.
+func tempFile(t *testing.T, b []byte) *os.File {
+	t.Helper()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "vsock"))
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+
+	if _, err := f.Write(b); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek file: %v", err)
+	}
+
+	return f
+}
@@ -0,0 +1,135 @@
+package vsock
+
+import (
+	"context"
+	"net"
+)
+
+var (
+	_ Transport = &Kernel{}
+	_ Transport = &Hybrid{}
+)
+
+// A Transport is an implementation of connection-oriented VM sockets. Code
+// which accepts a Transport rather than calling Dial and Listen directly can
+// be pointed at kernel VM sockets, hybrid vsock, or a fake network in tests.
+//
+// The net.Conn and net.Listener values returned by a Transport must report
+// their addresses as *Addr values.
+type Transport interface {
+	// Dial dials a VM sockets listener at the specified context ID and port.
+	Dial(ctx context.Context, contextID, port uint32) (net.Conn, error)
+
+	// Listen opens a listener for incoming VM sockets connections at the
+	// specified context ID and port.
+	Listen(ctx context.Context, contextID, port uint32) (net.Listener, error)
+
+	// ContextID returns the local context ID of this Transport.
+	ContextID() (uint32, error)
+}
+
+// A Kernel is a Transport which uses the AF_VSOCK sockets of the operating
+// system. The zero value is ready to use and is equivalent to calling
+// DialContext, ListenConfig.Listen, and ContextID with default options.
+type Kernel struct {
+	// Dialer, if not nil, specifies options for Dial.
+	Dialer *Dialer
+
+	// ListenConfig, if not nil, specifies options for Listen.
+	ListenConfig *ListenConfig
+}
+
+// Dial implements Transport. The returned net.Conn will always be of type
+// *Conn.
+func (k *Kernel) Dial(ctx context.Context, contextID, port uint32) (net.Conn, error) {
+	d := k.Dialer
+	if d == nil {
+		d = &Dialer{}
+	}
+
+	c, err := d.DialVsock(ctx, contextID, port)
+	if err != nil {
+		// Avoid returning a non-nil net.Conn containing a nil *Conn.
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Listen implements Transport. The returned net.Listener will always be of
+// type *Listener.
+func (k *Kernel) Listen(ctx context.Context, contextID, port uint32) (net.Listener, error) {
+	lc := k.ListenConfig
+	if lc == nil {
+		lc = &ListenConfig{}
+	}
+
+	l, err := lc.Listen(ctx, contextID, port)
+	if err != nil {
+		// Avoid returning a non-nil net.Listener containing a nil *Listener.
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// ContextID implements Transport by calling ContextID.
+func (*Kernel) ContextID() (uint32, error) { return ContextID() }
+
+// A Hybrid is a Transport which uses the hybrid vsock UNIX socket of a single
+// guest, as exposed by virtual machine monitors such as Firecracker and Cloud
+// Hypervisor. Because Path identifies the guest, the context ID parameter of
+// Dial is only used to report addresses, and that of Listen is ignored.
+//
+// See the documentation of DialHybrid and ListenHybrid for more details.
+type Hybrid struct {
+	// Path is the host UNIX socket path of the guest's hybrid vsock device.
+	Path string
+
+	// GuestContextID is the context ID configured for the guest's hybrid
+	// vsock device, which is reported as the remote address of Conns accepted
+	// by Listen. If zero, the wildcard context ID VMADDR_CID_ANY is reported.
+	GuestContextID uint32
+}
+
+// Dial implements Transport by calling DialHybrid. The returned net.Conn will
+// always be of type *Conn.
+func (h *Hybrid) Dial(ctx context.Context, contextID, port uint32) (net.Conn, error) {
+	c, err := DialHybrid(ctx, h.Path, contextID, port)
+	if err != nil {
+		// Avoid returning a non-nil net.Conn containing a nil *Conn.
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Listen implements Transport by calling ListenHybrid. The returned
+// net.Listener will always be of type *Listener.
+func (h *Hybrid) Listen(ctx context.Context, _, port uint32) (net.Listener, error) {
+	// Creating a Listener does not block, so the context is only checked for
+	// cancelation before any system calls are made.
+	if err := ctx.Err(); err != nil {
+		return nil, opError(opListen, err, &Addr{
+			ContextID: Host,
+			Port:      port,
+		}, nil)
+	}
+
+	guest := h.GuestContextID
+	if guest == 0 {
+		guest = cidAny
+	}
+
+	l, err := ListenHybrid(h.Path, guest, port)
+	if err != nil {
+		// Avoid returning a non-nil net.Listener containing a nil *Listener.
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// ContextID implements Transport. Hybrid vsock is only used by the host, so
+// ContextID always returns Host.
+func (*Hybrid) ContextID() (uint32, error) { return Host, nil }
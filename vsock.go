@@ -1,13 +1,21 @@
 package vsock
 
 import (
+	"context"
+	"encoding"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/mdlayher/vsock/internal/vserr"
 )
 
 const (
@@ -27,36 +35,178 @@ const (
 	// from a guest.
 	Host = 0x2
 
+	// FlagToHost is an Addr flag which specifies that a connection should be
+	// forwarded to the host, even if the destination context ID is not Host.
+	// This enables communication between sibling VMs and nested VMs through
+	// the host. The kernel also sets this flag on the remote address of
+	// connections which arrived in this way.
+	//
+	// FlagToHost requires Linux 5.11+.
+	FlagToHost = 0x1
+
+	// cidAny is the wildcard context ID, VMADDR_CID_ANY.
+	cidAny = 0xffffffff
+
+	// portAny is the wildcard port, VMADDR_PORT_ANY.
+	portAny = 0xffffffff
+
 	// Error numbers we recognize, copied here to avoid importing x/sys/unix in
 	// cross-platform code.
-	ebadf    = 9
-	enotconn = 107
+	ebadf      = 9
+	econnreset = 104
+	enotconn   = 107
+	etimedout  = 110
 
 	// devVsock is the location of /dev/vsock.  It is exposed on both the
 	// hypervisor and on virtual machines.
 	devVsock = "/dev/vsock"
 
 	// network is the vsock network reported in net.OpError.
-	network = "vsock"
+	network = vserr.Network
 
 	// Operation names which may be returned in net.OpError.
-	opAccept      = "accept"
-	opClose       = "close"
-	opDial        = "dial"
-	opListen      = "listen"
-	opRawControl  = "raw-control"
-	opRawRead     = "raw-read"
-	opRawWrite    = "raw-write"
-	opRead        = "read"
-	opSet         = "set"
-	opSyscallConn = "syscall-conn"
-	opWrite       = "write"
+	opAccept      = vserr.OpAccept
+	opClose       = vserr.OpClose
+	opDial        = vserr.OpDial
+	opFile        = vserr.OpFile
+	opGet         = vserr.OpGet
+	opListen      = vserr.OpListen
+	opRawControl  = vserr.OpRawControl
+	opRawRead     = vserr.OpRawRead
+	opRawWrite    = vserr.OpRawWrite
+	opRead        = vserr.OpRead
+	opReadFrom    = vserr.OpReadFrom
+	opSet         = vserr.OpSet
+	opSyscallConn = vserr.OpSyscallConn
+	opWrite       = vserr.OpWrite
+	opWriteTo     = vserr.OpWriteTo
+)
+
+// Sentinel errors which classify common VM sockets failures. Errors returned by
+// this package wrap the appropriate sentinel so it can be matched using
+// errors.Is, while still wrapping the underlying system call error.
+var (
+	// ErrNoDevice indicates that VM sockets are not available on this
+	// machine, such as when /dev/vsock does not exist or no VM sockets
+	// transport is loaded.
+	ErrNoDevice = errors.New("vsock: no VM sockets device")
+
+	// ErrPermission indicates that permission was denied, such as when
+	// opening /dev/vsock or entering a network namespace.
+	ErrPermission = errors.New("vsock: permission denied")
+
+	// ErrConnectionRefused indicates that a dial failed because no listener
+	// exists at the remote address.
+	ErrConnectionRefused = errors.New("vsock: connection refused")
+
+	// ErrHostUnreachable indicates that the remote context ID cannot be
+	// reached by any VM sockets transport.
+	ErrHostUnreachable = errors.New("vsock: host unreachable")
+
+	// ErrConnectTimeout indicates that the kernel's connect timeout expired
+	// while dialing. See Config.ConnectTimeout.
+	ErrConnectTimeout = errors.New("vsock: connect timeout exceeded")
+
+	// ErrTransportReset indicates that an established VM sockets connection
+	// was reset, such as when the VM sockets transport is reset after a
+	// virtual machine is migrated or restored from a snapshot.
+	//
+	// The kernel reports a reset by the peer with the same error, so a single
+	// connection failing with ErrTransportReset does not prove that the
+	// transport was reset; use WatchTransportReset to detect that. Hybrid
+	// vsock connections never fail with ErrTransportReset.
+	ErrTransportReset = errors.New("vsock: transport reset")
+
+	// ErrUnsupported indicates that an operation or option is not supported
+	// by this operating system, kernel, or VM sockets transport. It also
+	// matches errors.ErrUnsupported.
+	ErrUnsupported error = &unsupportedError{}
 )
 
-// TODO(mdlayher): plumb through socket.Config.NetNS if it makes sense.
+// An unsupportedError is the type of ErrUnsupported.
+type unsupportedError struct{}
+
+func (*unsupportedError) Error() string        { return "vsock: operation not supported" }
+func (*unsupportedError) Is(target error) bool { return target == errors.ErrUnsupported }
+
+// errMissingAddress is returned when a required address is nil.
+var errMissingAddress = errors.New("missing address")
 
 // Config contains options for a Conn or Listener.
-type Config struct{}
+type Config struct {
+	// Seqpacket specifies that a Conn or Listener should use SOCK_SEQPACKET
+	// sockets, which preserve message boundaries, rather than the default
+	// SOCK_STREAM sockets. Use the ReadMsg and WriteMsg methods of Conn to
+	// send and receive individual messages.
+	//
+	// SOCK_SEQPACKET VM sockets require Linux 5.16+.
+	Seqpacket bool
+
+	// BufferSize sets the size of a Conn's buffer in bytes using the
+	// SO_VM_SOCKETS_BUFFER_SIZE socket option. The kernel clamps the buffer
+	// size between the minimum and maximum buffer sizes. If zero, the kernel
+	// default is used.
+	//
+	// The buffer size options set on a Listener are inherited by all of the
+	// Conns it accepts. They are ignored by ListenPacket, because the kernel
+	// only supports them for connection-oriented VM sockets.
+	BufferSize uint64
+
+	// BufferMinSize sets the minimum size of a Conn's buffer in bytes using
+	// the SO_VM_SOCKETS_BUFFER_MIN_SIZE socket option. If zero, the kernel
+	// default is used.
+	BufferMinSize uint64
+
+	// BufferMaxSize sets the maximum size of a Conn's buffer in bytes using
+	// the SO_VM_SOCKETS_BUFFER_MAX_SIZE socket option. If zero, the kernel
+	// default is used.
+	BufferMaxSize uint64
+
+	// ConnectTimeout sets the kernel's timeout for establishing a connection
+	// when dialing using the SO_VM_SOCKETS_CONNECT_TIMEOUT socket option. This
+	// timeout is independent of any context or Dialer deadline. If zero, the
+	// kernel default of 2 seconds is used.
+	//
+	// If the kernel's connect timeout expires, the dial error will report true
+	// for its Timeout method.
+	ConnectTimeout time.Duration
+
+	// NetNS specifies the Linux network namespace a Conn, Listener, or
+	// PacketConn will operate in, as a file descriptor such as one opened from
+	// "/proc/<pid>/ns/net" or "/run/netns/<name>". This option is unsupported
+	// on other operating systems.
+	//
+	// If set (non-zero), the socket is created in the specified network
+	// namespace and an error will occur if entering the namespace fails.
+	// Entering a network namespace is a privileged operation (root or
+	// CAP_SYS_ADMIN are required). If not set (zero), the socket operates in
+	// the network namespace of the calling thread.
+	//
+	// The caller owns the file descriptor and is responsible for closing it.
+	// It is only used while creating a socket, so it may be closed as soon as
+	// the call which uses this Config returns.
+	//
+	// On kernels which do not support network namespaces for VM sockets, all
+	// VM sockets share a single global address space regardless of the
+	// network namespace they were created in. The context ID reported by
+	// ContextID and inferred by Listen is the same in all network namespaces.
+	NetNS int
+
+	// NetNSPath is like NetNS, but specifies the network namespace by the path
+	// of a file such as "/run/netns/<name>". The file is opened while creating
+	// a socket and closed before returning. Only one of NetNS and NetNSPath may
+	// be set.
+	NetNSPath string
+
+	// ZeroCopy enables the SO_ZEROCOPY socket option for a Conn, or for all
+	// of the Conns accepted by a Listener, so that Conn.WriteZeroCopy can send
+	// data without copying it into the kernel.
+	//
+	// If the kernel or VM sockets transport does not support zerocopy, this
+	// option is ignored and Conn.WriteZeroCopy copies data like Conn.Write.
+	// Zerocopy VM sockets require Linux 6.7+ and the virtio transport.
+	ZeroCopy bool
+}
 
 // Listen opens a connection-oriented net.Listener for incoming VM sockets
 // connections. The port parameter specifies the port for the Listener. Config
@@ -89,7 +239,52 @@ func Listen(port uint32, cfg *Config) (*Listener, error) {
 //
 // See the documentation of Listen for more details.
 func ListenContextID(contextID, port uint32, cfg *Config) (*Listener, error) {
-	l, err := listen(contextID, port, cfg)
+	lc := ListenConfig{Config: cfg}
+	return lc.Listen(context.Background(), contextID, port)
+}
+
+// ListenAny is the same as Listen, but binds the Listener to the wildcard
+// context ID VMADDR_CID_ANY rather than the context ID reported by ContextID.
+// This allows a single Listener to accept connections on any context ID of this
+// machine, such as from both Local clients and virtual machines, and to keep
+// working if the machine's context ID changes.
+//
+// The Listener's Addr method reports the wildcard context ID, while the
+// LocalAddr method of each accepted Conn reports the concrete context ID the
+// peer connected to.
+//
+// See the documentation of Listen for more details.
+func ListenAny(port uint32, cfg *Config) (*Listener, error) {
+	return ListenContextID(cidAny, port, cfg)
+}
+
+// A ListenConfig contains options for listening for VM sockets connections. The
+// zero value for each field is equivalent to listening without that option.
+// Listening with the zero value of ListenConfig is therefore equivalent to
+// calling ListenContextID.
+type ListenConfig struct {
+	// Control, if not nil, is called after creating the socket but before
+	// binding it. The network parameter is always "vsock" and the address
+	// parameter is the string form of the local *Addr.
+	Control func(network, address string, c syscall.RawConn) error
+
+	// Backlog specifies the maximum length of the queue of pending connections
+	// for the Listener. If zero, the system default is used.
+	Backlog int
+
+	// Config specifies optional configuration for the Listener. If nil, a
+	// default configuration will be used.
+	Config *Config
+}
+
+// Listen opens a connection-oriented net.Listener for incoming VM sockets
+// connections. The context ID and port parameters specify the address of the
+// Listener. The provided context must be non-nil. If the context is canceled
+// before the Listener is created, an error is returned.
+//
+// See the documentation of Listen and ListenContextID for more details.
+func (lc *ListenConfig) Listen(ctx context.Context, contextID, port uint32) (*Listener, error) {
+	l, err := listen(ctx, contextID, port, lc)
 	if err != nil {
 		// No remote address available.
 		return nil, opError(opListen, err, &Addr{
@@ -107,7 +302,8 @@ func ListenContextID(contextID, port uint32, cfg *Config) (*Listener, error) {
 // os.File does not affect the Listener.
 //
 // This function is intended for advanced use cases and most callers should use
-// Listen instead.
+// Listen instead. Processes started by systemd socket activation should use
+// ActivationListeners.
 func FileListener(f *os.File) (*Listener, error) {
 	l, err := fileListener(f)
 	if err != nil {
@@ -118,7 +314,28 @@ func FileListener(f *os.File) (*Listener, error) {
 	return l, nil
 }
 
-var _ net.Listener = &Listener{}
+// FileConn returns a copy of the network connection corresponding to an open
+// os.File. It is the caller's responsibility to close the Conn when finished.
+// Closing the Conn does not affect the os.File, and closing the os.File does
+// not affect the Conn.
+//
+// This function is intended for advanced use cases, such as receiving a
+// connection from another process, and most callers should use Dial or
+// Listener.Accept instead.
+func FileConn(f *os.File) (*Conn, error) {
+	c, err := fileConn(f)
+	if err != nil {
+		// No addresses available.
+		return nil, opError(opFile, err, nil, nil)
+	}
+
+	return c, nil
+}
+
+var (
+	_ net.Listener = &Listener{}
+	_ syscall.Conn = &Listener{}
+)
 
 // A Listener is a VM sockets implementation of a net.Listener.
 type Listener struct {
@@ -129,6 +346,18 @@ type Listener struct {
 // for the next call and returns a generic net.Conn. The returned net.Conn will
 // always be of type *Conn.
 func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.AcceptVsock()
+	if err != nil {
+		// Avoid returning a non-nil net.Conn containing a nil *Conn.
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// AcceptVsock waits for the next call and returns a *Conn. Most callers should
+// use AcceptVsock rather than Accept to avoid a type assertion.
+func (l *Listener) AcceptVsock() (*Conn, error) {
 	c, err := l.l.Accept()
 	if err != nil {
 		return nil, l.opError(opAccept, err)
@@ -139,20 +368,62 @@ func (l *Listener) Accept() (net.Conn, error) {
 
 // Addr returns the listener's network address, a *Addr. The Addr returned is
 // shared by all invocations of Addr, so do not modify it.
+//
+// For a Listener created by ListenAny, the context ID of the Addr is the
+// wildcard VMADDR_CID_ANY. Use the LocalAddr method of an accepted Conn to
+// determine the concrete context ID a peer connected to.
 func (l *Listener) Addr() net.Addr { return l.l.Addr() }
 
+// AddrPort returns the listener's network address as an AddrPort.
+func (l *Listener) AddrPort() AddrPort {
+	a, _ := l.Addr().(*Addr)
+	return a.AddrPort()
+}
+
 // Close stops listening on the VM sockets address. Already Accepted connections
 // are not closed.
 func (l *Listener) Close() error {
 	return l.opError(opClose, l.l.Close())
 }
 
+// File returns a copy of the underlying os.File. It is the caller's
+// responsibility to close the os.File when finished. Closing the Listener does
+// not affect the os.File, and closing the os.File does not affect the
+// Listener.
+//
+// The returned os.File's file descriptor is different from the Listener's.
+// Attempting to change properties of the original using this duplicate may or
+// may not have the desired effect.
+func (l *Listener) File() (*os.File, error) {
+	f, err := l.l.File()
+	if err != nil {
+		return nil, l.opError(opFile, err)
+	}
+
+	return f, nil
+}
+
 // SetDeadline sets the deadline associated with the listener. A zero time value
 // disables the deadline.
 func (l *Listener) SetDeadline(t time.Time) error {
 	return l.opError(opSet, l.l.SetDeadline(t))
 }
 
+// SyscallConn returns a raw network connection for the listening socket. This
+// implements the syscall.Conn interface.
+func (l *Listener) SyscallConn() (syscall.RawConn, error) {
+	rc, err := l.l.SyscallConn()
+	if err != nil {
+		return nil, l.opError(opSyscallConn, err)
+	}
+
+	a, _ := l.Addr().(*Addr)
+	return &rawConn{
+		rc:    rc,
+		local: a,
+	}, nil
+}
+
 // opError is a convenience for the function opError that also passes the local
 // address of the Listener.
 func (l *Listener) opError(op string, err error) error {
@@ -175,21 +446,251 @@ func (l *Listener) opError(op string, err error) error {
 // When the connection is no longer needed, Close must be called to free
 // resources.
 func Dial(contextID, port uint32, cfg *Config) (*Conn, error) {
-	c, err := dial(contextID, port, cfg)
+	return DialContext(context.Background(), contextID, port, cfg)
+}
+
+// DialContext is the same as Dial, but also accepts a context. The provided
+// context must be non-nil. If the context expires before the connection is
+// complete, an error is returned. Once successfully connected, any expiration
+// of the context will not affect the connection.
+//
+// See the documentation of Dial for more details.
+func DialContext(ctx context.Context, contextID, port uint32, cfg *Config) (*Conn, error) {
+	d := Dialer{Config: cfg}
+	return d.DialVsock(ctx, contextID, port)
+}
+
+// A Dialer contains options for connecting to a VM sockets listener. The zero
+// value for each field is equivalent to dialing without that option. Dialing
+// with the zero value of Dialer is therefore equivalent to calling Dial.
+type Dialer struct {
+	// Timeout is the maximum amount of time a dial will wait for a connect to
+	// complete. If Deadline is also set, it may fail earlier.
+	//
+	// The default is no timeout.
+	Timeout time.Duration
+
+	// Deadline is the absolute point in time after which dials will fail. If
+	// Timeout is also set, it may fail earlier. Zero means no deadline.
+	Deadline time.Time
+
+	// LocalAddr is the local address to bind when dialing. If nil, a local
+	// address is automatically chosen. A Port of 0 chooses any available port.
+	LocalAddr *Addr
+
+	// Control, if not nil, is called after creating the socket but before
+	// dialing. The network parameter is always "vsock" and the address
+	// parameter is the string form of the remote *Addr.
+	Control func(network, address string, c syscall.RawConn) error
+
+	// Config specifies optional configuration for the Conn. If nil, a default
+	// configuration will be used.
+	Config *Config
+}
+
+// DialVsock dials a VM sockets listener using the provided context. The
+// context ID and port parameters specify the address of the listener.
+//
+// See the documentation of Dial and DialContext for more details.
+func (d *Dialer) DialVsock(ctx context.Context, contextID, port uint32) (*Conn, error) {
+	return d.DialAddr(ctx, &Addr{
+		ContextID: contextID,
+		Port:      port,
+	})
+}
+
+// DialAddr is the same as DialVsock, but accepts the remote address as an
+// *Addr. This allows setting address flags such as FlagToHost.
+//
+// See the documentation of Dial and DialContext for more details.
+func (d *Dialer) DialAddr(ctx context.Context, raddr *Addr) (*Conn, error) {
+	if raddr == nil {
+		return nil, opError(opDial, errMissingAddress, nil, nil)
+	}
+
+	if deadline := d.deadline(ctx, time.Now()); !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	c, err := dial(ctx, raddr, d)
 	if err != nil {
 		// No local address, but we have a remote address we can return.
-		return nil, opError(opDial, err, nil, &Addr{
+		return nil, opError(opDial, err, nil, raddr)
+	}
+
+	return c, nil
+}
+
+// DialContext dials a VM sockets listener using the provided context. The
+// network parameter must be "vsock" or "tcp" and the address parameter must be
+// in a form accepted by ParseAddr, such as "3:1024".
+//
+// DialContext can be used as the DialContext function of types such as
+// http.Transport, which always dial the "tcp" network. The returned net.Conn
+// will always be of type *Conn.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "vsock", "tcp":
+	default:
+		return nil, opError(opDial, net.UnknownNetworkError(network), nil, nil)
+	}
+
+	addr, err := ParseAddr(address)
+	if err != nil {
+		return nil, opError(opDial, err, nil, nil)
+	}
+
+	c, err := d.DialAddr(ctx, addr)
+	if err != nil {
+		// Avoid returning a non-nil net.Conn containing a nil *Conn.
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// deadline returns the earliest of the Dialer's Timeout relative to now, the
+// Dialer's Deadline, and the deadline of ctx. If none are set, it returns the
+// zero time.
+func (d *Dialer) deadline(ctx context.Context, now time.Time) (earliest time.Time) {
+	if d.Timeout != 0 {
+		earliest = now.Add(d.Timeout)
+	}
+	if cd, ok := ctx.Deadline(); ok {
+		earliest = minNonzeroTime(earliest, cd)
+	}
+
+	return minNonzeroTime(earliest, d.Deadline)
+}
+
+// minNonzeroTime returns the earlier of a and b, ignoring either if it is zero.
+func minNonzeroTime(a, b time.Time) time.Time {
+	if a.IsZero() {
+		return b
+	}
+	if b.IsZero() || a.Before(b) {
+		return a
+	}
+
+	return b
+}
+
+// ListenPacket opens a connectionless net.PacketConn for sending and receiving
+// SOCK_DGRAM VM sockets datagrams. The context ID and port parameters specify
+// the local address of the PacketConn. Config specifies optional configuration
+// for the PacketConn. If config is nil, a default configuration will be used.
+//
+// To allow the system to assign a port automatically, specify 0 for port. The
+// address of the PacketConn can be retrieved using the LocalAddr method.
+//
+// Datagram VM sockets are only supported by some transports, such as VMCI. When
+// the PacketConn is no longer needed, Close must be called to free resources.
+//
+// The kernel only supports the VM sockets socket options for
+// connection-oriented sockets, so the buffer size, ConnectTimeout, Seqpacket,
+// and ZeroCopy fields of Config are ignored by ListenPacket.
+func ListenPacket(contextID, port uint32, cfg *Config) (*PacketConn, error) {
+	c, err := listenPacket(contextID, port, cfg)
+	if err != nil {
+		// No remote address available.
+		return nil, opError(opListen, err, &Addr{
 			ContextID: contextID,
 			Port:      port,
-		})
+		}, nil)
 	}
 
 	return c, nil
 }
 
 var (
-	_ net.Conn     = &Conn{}
-	_ syscall.Conn = &Conn{}
+	_ net.PacketConn = &PacketConn{}
+	_ syscall.Conn   = &PacketConn{}
+)
+
+// A PacketConn is a VM sockets implementation of a net.PacketConn.
+type PacketConn struct {
+	c     *packetConn
+	local *Addr
+}
+
+// Close closes the connection.
+func (c *PacketConn) Close() error {
+	return c.opError(opClose, c.c.Close(), nil)
+}
+
+// LocalAddr returns the local network address. The Addr returned is shared by
+// all invocations of LocalAddr, so do not modify it.
+func (c *PacketConn) LocalAddr() net.Addr { return c.local }
+
+// ReadFrom implements the net.PacketConn ReadFrom method. The returned net.Addr
+// is always of type *Addr.
+func (c *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.c.ReadFrom(b)
+	if err != nil {
+		return n, nil, c.opError(opRead, err, nil)
+	}
+
+	return n, addr, nil
+}
+
+// WriteTo implements the net.PacketConn WriteTo method. The addr parameter
+// must be of type *Addr.
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	a, ok := addr.(*Addr)
+	if !ok {
+		return 0, c.opError(opWrite, net.InvalidAddrError("address is not a *vsock.Addr"), addr)
+	}
+
+	n, err := c.c.WriteTo(b, a)
+	if err != nil {
+		return n, c.opError(opWrite, err, a)
+	}
+
+	return n, nil
+}
+
+// SetDeadline implements the net.PacketConn SetDeadline method.
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	return c.opError(opSet, c.c.SetDeadline(t), nil)
+}
+
+// SetReadDeadline implements the net.PacketConn SetReadDeadline method.
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	return c.opError(opSet, c.c.SetReadDeadline(t), nil)
+}
+
+// SetWriteDeadline implements the net.PacketConn SetWriteDeadline method.
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	return c.opError(opSet, c.c.SetWriteDeadline(t), nil)
+}
+
+// SyscallConn returns a raw network connection. This implements the
+// syscall.Conn interface.
+func (c *PacketConn) SyscallConn() (syscall.RawConn, error) {
+	rc, err := c.c.SyscallConn()
+	if err != nil {
+		return nil, c.opError(opSyscallConn, err, nil)
+	}
+
+	return &rawConn{
+		rc:    rc,
+		local: c.local,
+	}, nil
+}
+
+// opError is a convenience for the function opError that also passes the local
+// address of the PacketConn and the remote address of a datagram, if any.
+func (c *PacketConn) opError(op string, err error, remote net.Addr) error {
+	return opError(op, err, c.local, remote)
+}
+
+var (
+	_ net.Conn      = &Conn{}
+	_ syscall.Conn  = &Conn{}
+	_ io.ReaderFrom = &Conn{}
+	_ io.WriterTo   = &Conn{}
 )
 
 // A Conn is a VM sockets implementation of a net.Conn.
@@ -197,6 +698,14 @@ type Conn struct {
 	c      *conn
 	local  *Addr
 	remote *Addr
+
+	// zc is non-nil if Config.ZeroCopy is enabled and supported.
+	zc *zeroCopy
+
+	// hybrid is set for hybrid vsock Conns, which are backed by UNIX sockets.
+	hybrid bool
+
+	stats connStats
 }
 
 // Close closes the connection.
@@ -216,6 +725,22 @@ func (c *Conn) CloseWrite() error {
 	return c.opError(opClose, c.c.CloseWrite())
 }
 
+// File returns a copy of the underlying os.File. It is the caller's
+// responsibility to close the os.File when finished. Closing the Conn does not
+// affect the os.File, and closing the os.File does not affect the Conn.
+//
+// The returned os.File's file descriptor is different from the Conn's.
+// Attempting to change properties of the original using this duplicate may or
+// may not have the desired effect.
+func (c *Conn) File() (*os.File, error) {
+	f, err := dupFile(c.c, c.local.fileName()+"->"+c.remote.String())
+	if err != nil {
+		return nil, c.opError(opFile, err)
+	}
+
+	return f, nil
+}
+
 // LocalAddr returns the local network address. The Addr returned is shared by
 // all invocations of LocalAddr, so do not modify it.
 func (c *Conn) LocalAddr() net.Addr { return c.local }
@@ -224,9 +749,16 @@ func (c *Conn) LocalAddr() net.Addr { return c.local }
 // all invocations of RemoteAddr, so do not modify it.
 func (c *Conn) RemoteAddr() net.Addr { return c.remote }
 
+// LocalAddrPort returns the local network address as an AddrPort.
+func (c *Conn) LocalAddrPort() AddrPort { return c.local.AddrPort() }
+
+// RemoteAddrPort returns the remote network address as an AddrPort.
+func (c *Conn) RemoteAddrPort() AddrPort { return c.remote.AddrPort() }
+
 // Read implements the net.Conn Read method.
 func (c *Conn) Read(b []byte) (int, error) {
 	n, err := c.c.Read(b)
+	c.stats.read(int64(n))
 	if err != nil {
 		return n, c.opError(opRead, err)
 	}
@@ -237,6 +769,180 @@ func (c *Conn) Read(b []byte) (int, error) {
 // Write implements the net.Conn Write method.
 func (c *Conn) Write(b []byte) (int, error) {
 	n, err := c.c.Write(b)
+	c.stats.write(int64(n))
+	if err != nil {
+		return n, c.opError(opWrite, err)
+	}
+
+	return n, nil
+}
+
+// ReadFrom implements the io.ReaderFrom ReadFrom method. If r is backed by a
+// file descriptor through the syscall.Conn interface, such as an *os.File or a
+// *Conn, possibly wrapped in an *io.LimitedReader, ReadFrom uses sendfile(2) or
+// splice(2) where supported to move data into the Conn without copying it
+// through user space. Otherwise, such as for a blocking pipe which the runtime
+// cannot poll, ReadFrom falls back to a generic copy. If r is a *Conn, its
+// statistics are updated along with those of c.
+func (c *Conn) ReadFrom(r io.Reader) (int64, error) {
+	n, handled, err := readFrom(c.c, r)
+	if handled || n > 0 {
+		c.stats.write(n)
+
+		// Data moved by splice(2) bypasses the Read method of a source Conn.
+		src := r
+		if lr, ok := r.(*io.LimitedReader); ok {
+			src = lr.R
+		}
+		if sc, ok := src.(*Conn); ok {
+			sc.stats.read(n)
+		}
+	}
+	if !handled {
+		// Copy whatever remains. Write updates the statistics for each chunk.
+		var m int64
+		m, err = io.Copy(noReadFrom{c}, r)
+		n += m
+	}
+	if err != nil {
+		return n, c.opError(opReadFrom, err)
+	}
+
+	return n, nil
+}
+
+// WriteTo implements the io.WriterTo WriteTo method. If w is backed by a file
+// descriptor through the syscall.Conn interface, such as an *os.File or a
+// *Conn, WriteTo uses splice(2) where supported to move data out of the Conn
+// without copying it through user space. Otherwise, WriteTo falls back to a
+// generic copy. If w is a *Conn, its statistics are updated along with those
+// of c.
+func (c *Conn) WriteTo(w io.Writer) (int64, error) {
+	n, handled, err := writeTo(c.c, w)
+	if handled || n > 0 {
+		c.stats.read(n)
+
+		// Data moved by splice(2) bypasses the Write method of a destination
+		// Conn.
+		if dc, ok := w.(*Conn); ok {
+			dc.stats.write(n)
+		}
+	}
+	if !handled {
+		// Copy whatever remains. Read updates the statistics for each chunk.
+		var m int64
+		m, err = io.Copy(w, noWriteTo{c})
+		n += m
+	}
+	if err != nil {
+		return n, c.opError(opWriteTo, err)
+	}
+
+	return n, nil
+}
+
+// noReadFrom hides the ReadFrom method of a Conn so that a generic copy in
+// Conn.ReadFrom does not recurse.
+type noReadFrom struct{ c *Conn }
+
+func (w noReadFrom) Write(b []byte) (int, error) { return w.c.Write(b) }
+
+// noWriteTo hides the WriteTo method of a Conn so that a generic copy in
+// Conn.WriteTo does not recurse.
+type noWriteTo struct{ c *Conn }
+
+func (r noWriteTo) Read(b []byte) (int, error) { return r.c.Read(b) }
+
+// MsgFlags are flags which describe a message read by Conn.ReadMsg.
+type MsgFlags uint
+
+// Possible MsgFlags values.
+const (
+	// MsgTruncated indicates that a message was truncated because the buffer
+	// passed to ReadMsg was too small to hold it, as reported by MSG_TRUNC.
+	// The remainder of a truncated message is discarded.
+	MsgTruncated MsgFlags = 1 << iota
+
+	// MsgEOR indicates that a message ends a record, as reported by MSG_EOR.
+	// WriteMsg marks every message as the end of a record.
+	MsgEOR
+)
+
+// ReadMsg reads a single message from a SOCK_SEQPACKET Conn into b. It returns
+// the number of bytes copied into b and flags which report whether the
+// message was truncated because b was too small to hold it, and whether it
+// ends a record. ReadMsg returns io.EOF once the peer has shut down the
+// connection.
+//
+// ReadMsg may also be used with a SOCK_STREAM Conn, but because stream sockets
+// do not preserve message boundaries, no flags are ever reported.
+func (c *Conn) ReadMsg(b []byte) (n int, flags MsgFlags, err error) {
+	n, flags, err = readMsg(c.c, b)
+	c.stats.read(int64(n))
+	if err != nil {
+		return n, 0, c.opError(opRead, err)
+	}
+
+	return n, flags, nil
+}
+
+// WriteMsg writes b as a single message to a SOCK_SEQPACKET Conn, marking the
+// end of the message with MSG_EOR.
+func (c *Conn) WriteMsg(b []byte) (int, error) {
+	n, err := writeMsg(c.c, b)
+	c.stats.write(int64(n))
+	if err != nil {
+		return n, c.opError(opWrite, err)
+	}
+
+	return n, nil
+}
+
+// ReadBuffers reads data from the Conn into bufs using a single readv(2) system
+// call, filling each buffer in order. It returns the total number of bytes
+// read, which may be less than the combined length of bufs. At most 1024
+// buffers are used in a single call.
+func (c *Conn) ReadBuffers(bufs [][]byte) (int64, error) {
+	n, err := readBuffers(c.c, bufs)
+	c.stats.read(n)
+	if err != nil {
+		return n, c.opError(opRead, err)
+	}
+
+	return n, nil
+}
+
+// WriteBuffers writes the contents of bufs to the Conn using writev(2), so
+// that multiple buffers such as a message header and payload can be sent with
+// a single system call. It returns the total number of bytes written. The
+// contents of bufs are not modified.
+//
+// Unlike net.Buffers.WriteTo, which issues a separate Write for each buffer
+// when used with a Conn, WriteBuffers always uses vectored I/O.
+func (c *Conn) WriteBuffers(bufs net.Buffers) (int64, error) {
+	n, err := writeBuffers(c.c, bufs)
+	c.stats.write(n)
+	if err != nil {
+		return n, c.opError(opWrite, err)
+	}
+
+	return n, nil
+}
+
+// WriteZeroCopy writes b to the Conn using MSG_ZEROCOPY, which allows the kernel
+// to transmit data directly from b rather than copying it. WriteZeroCopy blocks
+// until the kernel reports that it no longer references b, so b may be reused
+// as soon as WriteZeroCopy returns. If the Conn is closed or its write deadline
+// expires while WriteZeroCopy is waiting, the kernel may still reference b.
+//
+// Zerocopy is only worthwhile for large writes. If Config.ZeroCopy was not
+// set, or zerocopy is unsupported by the kernel or VM sockets transport,
+// WriteZeroCopy behaves like Write. Concurrent calls to WriteZeroCopy are
+// serialized, but other reads and writes may proceed while WriteZeroCopy
+// waits for the kernel.
+func (c *Conn) WriteZeroCopy(b []byte) (int, error) {
+	n, err := writeZeroCopy(c.c, c.zc, b)
+	c.stats.write(int64(n))
 	if err != nil {
 		return n, c.opError(opWrite, err)
 	}
@@ -246,7 +952,12 @@ func (c *Conn) Write(b []byte) (int, error) {
 
 // SetDeadline implements the net.Conn SetDeadline method.
 func (c *Conn) SetDeadline(t time.Time) error {
-	return c.opError(opSet, c.c.SetDeadline(t))
+	if err := c.c.SetDeadline(t); err != nil {
+		return c.opError(opSet, err)
+	}
+
+	c.setZeroCopyDeadline(t)
+	return nil
 }
 
 // SetReadDeadline implements the net.Conn SetReadDeadline method.
@@ -254,9 +965,70 @@ func (c *Conn) SetReadDeadline(t time.Time) error {
 	return c.opError(opSet, c.c.SetReadDeadline(t))
 }
 
-// SetWriteDeadline implements the net.Conn SetWriteDeadline method.
+// SetWriteDeadline implements the net.Conn SetWriteDeadline method. The write
+// deadline also applies to WriteZeroCopy while it waits for the kernel.
 func (c *Conn) SetWriteDeadline(t time.Time) error {
-	return c.opError(opSet, c.c.SetWriteDeadline(t))
+	if err := c.c.SetWriteDeadline(t); err != nil {
+		return c.opError(opSet, err)
+	}
+
+	c.setZeroCopyDeadline(t)
+	return nil
+}
+
+// setZeroCopyDeadline applies the write deadline t to WriteZeroCopy, if
+// zerocopy is enabled.
+func (c *Conn) setZeroCopyDeadline(t time.Time) {
+	if c.zc != nil {
+		c.zc.setDeadline(t)
+	}
+}
+
+// BufferSize returns the size of the Conn's buffer in bytes, as reported by the
+// SO_VM_SOCKETS_BUFFER_SIZE socket option.
+func (c *Conn) BufferSize() (uint64, error) {
+	n, err := bufferSize(c.c)
+	if err != nil {
+		return 0, c.opError(opGet, err)
+	}
+
+	return n, nil
+}
+
+// SetBufferSize sets the size of the Conn's buffer in bytes using the
+// SO_VM_SOCKETS_BUFFER_SIZE socket option. Because the kernel clamps the
+// buffer size between the minimum and maximum buffer sizes, SetBufferSize also
+// adjusts those limits when necessary so that n takes effect.
+func (c *Conn) SetBufferSize(n uint64) error {
+	return c.opError(opSet, setBufferSize(c.c, n))
+}
+
+// ConnectTimeout returns the kernel's connect timeout for the Conn, as reported
+// by the SO_VM_SOCKETS_CONNECT_TIMEOUT socket option.
+func (c *Conn) ConnectTimeout() (time.Duration, error) {
+	d, err := connectTimeout(c.c)
+	if err != nil {
+		return 0, c.opError(opGet, err)
+	}
+
+	return d, nil
+}
+
+// Stats returns traffic and kernel queue statistics for the Conn.
+func (c *Conn) Stats() (ConnStats, error) {
+	inq, outq, err := queueDepths(c.c)
+	if err != nil {
+		return ConnStats{}, c.opError(opGet, err)
+	}
+
+	return ConnStats{
+		BytesRead:    c.stats.bytesRead.Load(),
+		BytesWritten: c.stats.bytesWritten.Load(),
+		Reads:        c.stats.reads.Load(),
+		Writes:       c.stats.writes.Load(),
+		ReadQueue:    inq,
+		WriteQueue:   outq,
+	}, nil
 }
 
 // SyscallConn returns a raw network connection. This implements the
@@ -275,11 +1047,64 @@ func (c *Conn) SyscallConn() (syscall.RawConn, error) {
 }
 
 // opError is a convenience for the function opError that also passes the local
-// and remote addresses of the Conn.
+// and remote addresses of the Conn. It also notifies WatchTransportReset of any
+// failures which may have been caused by a transport reset.
 func (c *Conn) opError(op string, err error) error {
+	// Only VM sockets connections can be reset by their transport, as opposed
+	// to hybrid vsock connections backed by UNIX sockets.
+	if err != nil && !c.hybrid && isErrno(err, econnreset) {
+		err = vserr.WithSentinel(err, ErrTransportReset)
+		resets.notify(c)
+	}
+
 	return opError(op, err, c.local, c.remote)
 }
 
+// ConnStats contains traffic and kernel queue statistics for a Conn.
+type ConnStats struct {
+	// BytesRead and BytesWritten are the total number of bytes read from and
+	// written to the Conn by all of its I/O methods. This includes data moved
+	// by ReadFrom or WriteTo of another Conn with this Conn as its source or
+	// destination.
+	BytesRead, BytesWritten uint64
+
+	// Reads and Writes are the number of read and write operations performed
+	// on the Conn, including those which returned an error.
+	Reads, Writes uint64
+
+	// ReadQueue is the number of bytes received by the kernel which have not
+	// yet been read from the Conn, as reported by the SIOCINQ ioctl.
+	//
+	// WriteQueue is the number of bytes written to the Conn which the kernel
+	// has not yet sent to the peer, as reported by the SIOCOUTQ ioctl.
+	//
+	// Each value is -1 if it is not supported by the kernel or VM sockets
+	// transport.
+	ReadQueue, WriteQueue int
+}
+
+// connStats contains the traffic counters for a Conn.
+type connStats struct {
+	bytesRead, bytesWritten atomic.Uint64
+	reads, writes           atomic.Uint64
+}
+
+// read records a read operation of n bytes.
+func (s *connStats) read(n int64) {
+	s.reads.Add(1)
+	if n > 0 {
+		s.bytesRead.Add(uint64(n))
+	}
+}
+
+// write records a write operation of n bytes.
+func (s *connStats) write(n int64) {
+	s.writes.Add(1)
+	if n > 0 {
+		s.bytesWritten.Add(uint64(n))
+	}
+}
+
 // TODO(mdlayher): see if we can port smarter net.OpError with local/remote
 // address error logic into socket.Conn's SyscallConn type to avoid the need for
 // this wrapper.
@@ -314,33 +1139,198 @@ func (rc *rawConn) opError(op string, err error) error {
 	return opError(op, err, rc.local, rc.remote)
 }
 
-var _ net.Addr = &Addr{}
+var (
+	_ net.Addr                 = &Addr{}
+	_ encoding.TextMarshaler   = &Addr{}
+	_ encoding.TextUnmarshaler = &Addr{}
+	_ flag.Value               = &Addr{}
+)
 
 // An Addr is the address of a VM sockets endpoint.
 type Addr struct {
 	ContextID, Port uint32
+
+	// Flags specifies optional address flags, such as FlagToHost.
+	Flags uint8
 }
 
 // Network returns the address's network name, "vsock".
 func (a *Addr) Network() string { return network }
 
 // String returns a human-readable representation of Addr, and indicates if
-// ContextID is meant to be used for a hypervisor, host, VM, etc.
+// ContextID is meant to be used for a hypervisor, host, VM, etc. Any flags are
+// listed after the context ID, such as "vm(4,to-host):1024".
 func (a *Addr) String() string {
-	var host string
+	name := cidName(a.ContextID)
+	if a.Flags == 0 {
+		return fmt.Sprintf("%s(%d):%d", name, a.ContextID, a.Port)
+	}
+
+	return fmt.Sprintf("%s(%d,%s):%d", name, a.ContextID, flagsString(a.Flags), a.Port)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. The encoding is
+// the same as returned by String.
+func (a *Addr) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. The address
+// is expected in a form accepted by ParseAddr.
+func (a *Addr) UnmarshalText(text []byte) error {
+	addr, err := ParseAddr(string(text))
+	if err != nil {
+		return err
+	}
+
+	*a = *addr
+	return nil
+}
+
+// Set implements the flag.Value interface, so that an *Addr may be used with
+// flag.Var. The address is expected in a form accepted by ParseAddr.
+func (a *Addr) Set(s string) error {
+	return a.UnmarshalText([]byte(s))
+}
 
-	switch a.ContextID {
+// cidName returns the name of a context ID as displayed by Addr.String.
+func cidName(cid uint32) string {
+	switch cid {
 	case Hypervisor:
-		host = fmt.Sprintf("hypervisor(%d)", a.ContextID)
+		return "hypervisor"
 	case Local:
-		host = fmt.Sprintf("local(%d)", a.ContextID)
+		return "local"
 	case Host:
-		host = fmt.Sprintf("host(%d)", a.ContextID)
+		return "host"
+	case cidAny:
+		return "any"
 	default:
-		host = fmt.Sprintf("vm(%d)", a.ContextID)
+		return "vm"
+	}
+}
+
+// cidNames maps the symbolic context IDs accepted by ParseAddr to their values.
+var cidNames = map[string]uint32{
+	"hypervisor": Hypervisor,
+	"local":      Local,
+	"host":       Host,
+	"any":        cidAny,
+}
+
+// flagsString returns a human-readable representation of Addr flags.
+func flagsString(flags uint8) string {
+	var ss []string
+	if flags&FlagToHost != 0 {
+		ss = append(ss, "to-host")
+		flags &^= FlagToHost
+	}
+
+	if flags != 0 {
+		// Unknown flags.
+		ss = append(ss, fmt.Sprintf("%#x", flags))
+	}
+
+	return strings.Join(ss, "|")
+}
+
+// ParseAddr parses s as a VM sockets address. The following forms are
+// accepted:
+//   - "contextID:port", such as "3:1024"
+//   - the form returned by Addr.String, such as "vm(3):1024" or
+//     "vm(4,to-host):1024"
+//   - a symbolic context ID of "hypervisor", "local", "host", or "any" and a
+//     port, such as "host:1024"
+//
+// Any of these forms may also be prefixed by "vsock://", such as
+// "vsock://3:1024".
+func ParseAddr(s string) (*Addr, error) {
+	addr, err := parseAddr(strings.TrimPrefix(s, "vsock://"))
+	if err != nil {
+		return nil, &net.AddrError{Err: err.Error(), Addr: s}
+	}
+
+	return addr, nil
+}
+
+// parseAddr is the implementation of ParseAddr for an address without a URL
+// scheme.
+func parseAddr(s string) (*Addr, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i == -1 {
+		return nil, errors.New("missing port in address")
+	}
+
+	port, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid port")
+	}
+
+	cid, flags, err := parseContextID(s[:i])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Addr{
+		ContextID: cid,
+		Port:      uint32(port),
+		Flags:     flags,
+	}, nil
+}
+
+// parseContextID parses the context ID and flags portion of an address.
+func parseContextID(s string) (uint32, uint8, error) {
+	if cid, ok := cidNames[s]; ok {
+		return cid, 0, nil
+	}
+	if cid, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(cid), 0, nil
+	}
+
+	// Anything else must be in the form returned by Addr.String, where the
+	// name must match the one that would be displayed for the context ID.
+	errInvalid := errors.New("invalid context ID")
+
+	name, rest, ok := strings.Cut(s, "(")
+	if !ok || !strings.HasSuffix(rest, ")") {
+		return 0, 0, errInvalid
+	}
+
+	scid, sflags, hasFlags := strings.Cut(strings.TrimSuffix(rest, ")"), ",")
+	cid, err := strconv.ParseUint(scid, 10, 32)
+	if err != nil || cidName(uint32(cid)) != name {
+		return 0, 0, errInvalid
+	}
+
+	if !hasFlags {
+		return uint32(cid), 0, nil
+	}
+
+	flags, err := parseFlags(sflags)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uint32(cid), flags, nil
+}
+
+// parseFlags parses Addr flags in the form returned by flagsString.
+func parseFlags(s string) (uint8, error) {
+	var flags uint8
+	for f := range strings.SplitSeq(s, "|") {
+		if f == "to-host" {
+			flags |= FlagToHost
+			continue
+		}
+
+		v, err := strconv.ParseUint(f, 0, 8)
+		if err != nil {
+			return 0, errors.New("invalid flags")
+		}
+
+		flags |= uint8(v)
 	}
 
-	return fmt.Sprintf("%s:%d", host, a.Port)
+	return flags, nil
 }
 
 // fileName returns a file name for use with os.NewFile for Addr.
@@ -354,8 +1344,16 @@ func (a *Addr) fileName() string {
 //
 // If the kernel module is unavailable, access to the kernel module is denied,
 // or VM sockets are unsupported on this system, it returns an error.
+//
+// The context ID belongs to the machine rather than to a network namespace, so
+// ContextID reports the same value regardless of Config.NetNS.
 func ContextID() (uint32, error) {
-	return contextID()
+	cid, err := contextID()
+	if err != nil {
+		return 0, withSentinel(opGet, err)
+	}
+
+	return cid, nil
 }
 
 // opError unpacks err if possible, producing a net.OpError with the input
@@ -396,39 +1394,43 @@ func opError(op string, err error, local, remote net.Addr) error {
 		// We may see a literal io.EOF as happens with x/net/nettest, but
 		// "transport not connected" also means io.EOF in Go.
 		return io.EOF
-	case err == os.ErrClosed, isErrno(err, ebadf), strings.Contains(err.Error(), "use of closed"):
+	case errors.Is(err, os.ErrClosed), errors.Is(err, net.ErrClosed), isErrno(err, ebadf),
+		strings.Contains(err.Error(), "use of closed"):
 		// Different operations may return different errors that all effectively
 		// indicate a closed file.
 		//
 		// To rectify the differences, net.TCPConn uses an error with this text
 		// from internal/poll for the backing file already being closed.
 		err = net.ErrClosed
+	case op == opDial && isErrno(err, etimedout):
+		// The kernel's connect timeout expired, as opposed to a deadline set
+		// by the caller.
+		err = &connectTimeoutError{err: err}
 	default:
-		// Nothing to do, return this directly.
+		// Classify the error if possible, otherwise return this directly.
+		err = withSentinel(op, err)
 	}
 
-	// Determine source and addr using the rules defined by net.OpError's
-	// documentation: https://golang.org/pkg/net/#OpError.
-	var source, addr net.Addr
-	switch op {
-	case opClose, opDial, opRawRead, opRawWrite, opRead, opWrite:
-		if local != nil {
-			source = local
-		}
-		if remote != nil {
-			addr = remote
-		}
-	case opAccept, opListen, opRawControl, opSet, opSyscallConn:
-		if local != nil {
-			addr = local
-		}
-	}
+	return vserr.OpError(op, err, local, remote)
+}
 
-	return &net.OpError{
-		Op:     op,
-		Net:    network,
-		Source: source,
-		Addr:   addr,
-		Err:    err,
-	}
+// withSentinel wraps err with the sentinel error which classifies it, if any.
+func withSentinel(op string, err error) error {
+	return vserr.WithSentinel(err, errorSentinel(op, err))
 }
+
+var _ net.Error = &connectTimeoutError{}
+
+// A connectTimeoutError indicates that the kernel's connect timeout expired
+// while dialing. See Config.ConnectTimeout.
+type connectTimeoutError struct {
+	err error
+}
+
+func (e *connectTimeoutError) Error() string {
+	return "connect timeout exceeded: " + e.err.Error()
+}
+
+func (e *connectTimeoutError) Unwrap() []error { return []error{e.err, ErrConnectTimeout} }
+func (e *connectTimeoutError) Timeout() bool   { return true }
+func (e *connectTimeoutError) Temporary() bool { return true }
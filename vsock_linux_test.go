@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/socket"
 	"golang.org/x/sys/unix"
 )
 
@@ -127,6 +128,19 @@ func Test_opError(t *testing.T) {
 				Err:    errClosed,
 			},
 		},
+		{
+			name:   "op dial ETIMEDOUT",
+			op:     opDial,
+			err:    os.NewSyscallError("connect", unix.ETIMEDOUT),
+			remote: remote,
+			want: &net.OpError{
+				Op:   opDial,
+				Addr: remote,
+				Err: &connectTimeoutError{
+					err: os.NewSyscallError("connect", unix.ETIMEDOUT),
+				},
+			},
+		},
 		{
 			name:   "op raw-read",
 			op:     opRawRead,
@@ -190,6 +204,17 @@ func Test_opError(t *testing.T) {
 				Err:  errClosed,
 			},
 		},
+		{
+			name:  "op get",
+			op:    opGet,
+			err:   errClosed,
+			local: local,
+			want: &net.OpError{
+				Op:   opGet,
+				Addr: local,
+				Err:  errClosed,
+			},
+		},
 		{
 			name:  "op listen",
 			op:    opListen,
@@ -273,6 +298,356 @@ func Test_opError(t *testing.T) {
 	}
 }
 
+func Test_opErrorConnectTimeout(t *testing.T) {
+	err := opError(opDial, os.NewSyscallError("connect", unix.ETIMEDOUT), nil, nil)
+
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("expected timeout net.Error, but got: %#v", err)
+	}
+
+	if !errors.Is(err, unix.ETIMEDOUT) {
+		t.Fatalf("expected ETIMEDOUT, but got: %v", err)
+	}
+
+	if !errors.Is(err, ErrConnectTimeout) {
+		t.Fatalf("expected ErrConnectTimeout, but got: %v", err)
+	}
+}
+
+func Test_opErrorSentinels(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       string
+		err      error
+		sentinel error
+	}{
+		{
+			name: "no device",
+			op:   opListen,
+			err: &os.PathError{
+				Op:   "open",
+				Path: devVsock,
+				Err:  unix.ENOENT,
+			},
+			sentinel: ErrNoDevice,
+		},
+		{
+			name:     "no transport",
+			op:       opDial,
+			err:      os.NewSyscallError("connect", unix.ENODEV),
+			sentinel: ErrNoDevice,
+		},
+		{
+			name:     "permission",
+			op:       opListen,
+			err:      os.NewSyscallError("socket", unix.EPERM),
+			sentinel: ErrPermission,
+		},
+		{
+			name:     "refused",
+			op:       opDial,
+			err:      os.NewSyscallError("connect", unix.ECONNRESET),
+			sentinel: ErrConnectionRefused,
+		},
+		{
+			name:     "unreachable",
+			op:       opDial,
+			err:      os.NewSyscallError("connect", unix.ENETUNREACH),
+			sentinel: ErrHostUnreachable,
+		},
+		{
+			name:     "connect timeout",
+			op:       opDial,
+			err:      os.NewSyscallError("connect", unix.ETIMEDOUT),
+			sentinel: ErrConnectTimeout,
+		},
+		{
+			name:     "unsupported",
+			op:       opListen,
+			err:      os.NewSyscallError("socket", unix.ESOCKTNOSUPPORT),
+			sentinel: ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := opError(tt.op, tt.err, nil, nil)
+
+			// Both the sentinel and the original errno must match.
+			if !errors.Is(err, tt.sentinel) {
+				t.Fatalf("expected %v, but got: %v", tt.sentinel, err)
+			}
+
+			var errno unix.Errno
+			if !errors.As(tt.err, &errno) || !errors.Is(err, errno) {
+				t.Fatalf("expected errno %v, but got: %v", errno, err)
+			}
+
+			// The message is unchanged, other than for connect timeouts.
+			if tt.sentinel != ErrConnectTimeout {
+				if diff := cmp.Diff(tt.err.Error(), err.(*net.OpError).Err.Error()); diff != "" {
+					t.Fatalf("unexpected error message (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+
+	// Unclassified errors are not wrapped.
+	err := opError(opRead, os.NewSyscallError("read", unix.EIO), nil, nil)
+	if diff := cmp.Diff(os.NewSyscallError("read", unix.EIO), err.(*net.OpError).Err); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnOpErrorTransportReset(t *testing.T) {
+	sub, unsubscribe := resets.subscribe()
+	defer unsubscribe()
+
+	c := &Conn{
+		local:  &Addr{ContextID: 3, Port: 1024},
+		remote: &Addr{ContextID: Host, Port: 2048},
+	}
+
+	// Other errors must not be reported as resets.
+	_ = c.opError(opRead, os.NewSyscallError("read", unix.EIO))
+	if n := sub.take(); n != 0 {
+		t.Fatalf("unexpected reset notifications: %d", n)
+	}
+
+	err := c.opError(opRead, os.NewSyscallError("read", unix.ECONNRESET))
+	if !errors.Is(err, ErrTransportReset) || !errors.Is(err, unix.ECONNRESET) {
+		t.Fatalf("expected ErrTransportReset, but got: %v", err)
+	}
+	if n := sub.take(); n != 1 {
+		t.Fatalf("expected a reset notification, but got: %d", n)
+	}
+
+	// Hybrid vsock connections are UNIX sockets and cannot be reset by a VM
+	// sockets transport.
+	hc := &Conn{
+		local:  &Addr{ContextID: Host, Port: 1024},
+		remote: &Addr{ContextID: cidAny, Port: 2048},
+		hybrid: true,
+	}
+
+	err = hc.opError(opRead, os.NewSyscallError("read", unix.ECONNRESET))
+	if errors.Is(err, ErrTransportReset) || !errors.Is(err, unix.ECONNRESET) {
+		t.Fatalf("expected plain connection reset, but got: %v", err)
+	}
+	if n := sub.take(); n != 0 {
+		t.Fatalf("unexpected reset notifications: %d", n)
+	}
+}
+
+func TestAddrPortSockaddr(t *testing.T) {
+	sa := &unix.SockaddrVM{
+		CID:   4,
+		Port:  1024,
+		Flags: unix.VMADDR_FLAG_TO_HOST,
+	}
+
+	ap := AddrPortFromSockaddr(sa)
+	if diff := cmp.Diff((&Addr{ContextID: 4, Port: 1024, Flags: FlagToHost}).AddrPort(), ap,
+		cmp.Comparer(func(x, y AddrPort) bool { return x == y })); diff != "" {
+		t.Fatalf("unexpected AddrPort (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(sa, ap.Sockaddr(), cmp.AllowUnexported(unix.SockaddrVM{})); diff != "" {
+		t.Fatalf("unexpected sockaddr (-want +got):\n%s", diff)
+	}
+}
+
+func Test_writeBuffers(t *testing.T) {
+	c, peer := socketPair(t)
+
+	// Use more buffers than can be passed to a single writev(2) call, and
+	// include empty buffers which must be skipped.
+	var (
+		bufs net.Buffers
+		want []byte
+	)
+	for i := range 2*maxIovecs + 1 {
+		b := []byte{byte(i)}
+		if i%3 == 0 {
+			b = nil
+		}
+
+		bufs = append(bufs, b)
+		want = append(want, b...)
+	}
+
+	orig := append(net.Buffers(nil), bufs...)
+
+	n, err := writeBuffers(c, bufs)
+	if err != nil {
+		t.Fatalf("failed to write buffers: %v", err)
+	}
+	if diff := cmp.Diff(int64(len(want)), n); diff != "" {
+		t.Fatalf("unexpected number of bytes (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(orig, bufs); diff != "" {
+		t.Fatalf("buffers were modified (-want +got):\n%s", diff)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(peer, got); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+}
+
+func Test_readBuffers(t *testing.T) {
+	c, peer := socketPair(t)
+
+	if _, err := peer.Write([]byte("hello world")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	_ = peer.Close()
+
+	bufs := [][]byte{make([]byte, 5), nil, make([]byte, 1), make([]byte, 10)}
+	n, err := readBuffers(c, bufs)
+	if err != nil {
+		t.Fatalf("failed to read buffers: %v", err)
+	}
+	if diff := cmp.Diff(int64(11), n); diff != "" {
+		t.Fatalf("unexpected number of bytes (-want +got):\n%s", diff)
+	}
+
+	want := [][]byte{[]byte("hello"), nil, []byte(" "), []byte("world")}
+	got := [][]byte{bufs[0], bufs[1], bufs[2], bufs[3][:5]}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+
+	// The peer is closed, so the next read reports EOF.
+	if _, err := readBuffers(c, bufs); err != io.EOF {
+		t.Fatalf("expected EOF, but got: %v", err)
+	}
+}
+
+func Test_newSocketNetNSErrors(t *testing.T) {
+	if _, err := newSocket(unix.SOCK_STREAM, &Config{NetNS: 1, NetNSPath: "/proc/self/ns/net"}); !errors.Is(err, errNetNSConflict) {
+		t.Fatalf("expected conflicting network namespace error, but got: %v", err)
+	}
+
+	if _, err := newSocket(unix.SOCK_STREAM, &Config{NetNSPath: "/nonexistent/netns"}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected network namespace not found error, but got: %v", err)
+	}
+}
+
+func TestConnReadMsg(t *testing.T) {
+	// UNIX sockets also support SOCK_SEQPACKET, which is sufficient to exercise
+	// message truncation and shutdown without a VM sockets loopback transport.
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("failed to open socket pair: %v", err)
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "unix")
+	sc, err := socket.FileConn(f, "unix")
+	_ = f.Close()
+	if err != nil {
+		t.Fatalf("failed to open conn: %v", err)
+	}
+
+	c := &Conn{c: sc}
+	defer c.Close()
+
+	peer := os.NewFile(uintptr(fds[1]), "unix-peer")
+	for _, msg := range []string{"hello", "world!"} {
+		if _, err := peer.Write([]byte(msg)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+	_ = peer.Close()
+
+	b := make([]byte, 5)
+	for _, want := range []struct {
+		s     string
+		flags MsgFlags
+	}{
+		{s: "hello"},
+		{s: "world", flags: MsgTruncated},
+	} {
+		n, flags, err := c.ReadMsg(b)
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+
+		if diff := cmp.Diff(want.s, string(b[:n])); diff != "" {
+			t.Fatalf("unexpected message (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(want.flags, flags); diff != "" {
+			t.Fatalf("unexpected flags (-want +got):\n%s", diff)
+		}
+	}
+
+	// The peer has shut down, so ReadMsg reports io.EOF like Read.
+	if _, _, err := c.ReadMsg(b); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+}
+
+func TestConnStats(t *testing.T) {
+	// UNIX sockets also support SIOCINQ and SIOCOUTQ, so they are sufficient
+	// to exercise the statistics without a VM sockets loopback transport.
+	sc, peer := socketPair(t)
+	c := &Conn{
+		c:      sc,
+		local:  &Addr{ContextID: Local, Port: 1024},
+		remote: &Addr{ContextID: Local, Port: 2048},
+	}
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if _, err := c.WriteBuffers(net.Buffers{[]byte("foo"), []byte("bar")}); err != nil {
+		t.Fatalf("failed to write buffers: %v", err)
+	}
+
+	// Leave data in the receive queue.
+	if _, err := peer.Write([]byte("hello world")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c, b); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	// Drain the send queue so it is empty.
+	if _, err := io.ReadFull(peer, make([]byte, 11)); err != nil {
+		t.Fatalf("failed to read peer: %v", err)
+	}
+
+	got, err := c.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+
+	want := ConnStats{
+		BytesRead:    5,
+		BytesWritten: 11,
+		Reads:        1,
+		Writes:       2,
+		ReadQueue:    6,
+		WriteQueue:   0,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	_ = c.Close()
+	if _, err := c.Stats(); err == nil {
+		t.Fatal("expected an error after close, but none occurred")
+	}
+}
+
 func errorsEqual(x, y error) bool {
 	if x == nil || y == nil {
 		return x == nil && y == nil
@@ -4,7 +4,9 @@
 package vsock
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"runtime"
@@ -13,20 +15,37 @@ import (
 )
 
 // errUnimplemented is returned by all functions on platforms that
-// cannot make use of VM sockets.
-var errUnimplemented = fmt.Errorf("vsock: not implemented on %s", runtime.GOOS)
+// cannot make use of VM sockets. It matches ErrUnsupported.
+var errUnimplemented error = &unimplementedError{}
 
-func fileListener(_ *os.File) (*Listener, error)       { return nil, errUnimplemented }
-func listen(_, _ uint32, _ *Config) (*Listener, error) { return nil, errUnimplemented }
+// An unimplementedError is the type of errUnimplemented.
+type unimplementedError struct{}
+
+func (*unimplementedError) Error() string {
+	return fmt.Sprintf("vsock: not implemented on %s", runtime.GOOS)
+}
+func (*unimplementedError) Unwrap() error { return ErrUnsupported }
+
+func fileListener(_ *os.File) (*Listener, error) { return nil, errUnimplemented }
+func listen(_ context.Context, _, _ uint32, _ *ListenConfig) (*Listener, error) {
+	return nil, errUnimplemented
+}
 
 type listener struct{}
 
-func (*listener) Accept() (net.Conn, error)     { return nil, errUnimplemented }
+func (*listener) Accept() (*Conn, error)        { return nil, errUnimplemented }
 func (*listener) Addr() net.Addr                { return nil }
 func (*listener) Close() error                  { return errUnimplemented }
+func (*listener) File() (*os.File, error)       { return nil, errUnimplemented }
 func (*listener) SetDeadline(_ time.Time) error { return errUnimplemented }
 
-func dial(_, _ uint32, _ *Config) (*Conn, error) { return nil, errUnimplemented }
+func (*listener) SyscallConn() (syscall.RawConn, error) { return nil, errUnimplemented }
+
+func dial(_ context.Context, _ *Addr, _ *Dialer) (*Conn, error) { return nil, errUnimplemented }
+func listenHybrid(_ string, _, _ uint32) (*Listener, error)     { return nil, errUnimplemented }
+func dialHybrid(_ context.Context, _ string, _, _ uint32) (*Conn, error) {
+	return nil, errUnimplemented
+}
 
 type conn struct{}
 
@@ -40,6 +59,50 @@ func (*conn) SetReadDeadline(_ time.Time) error     { return errUnimplemented }
 func (*conn) SetWriteDeadline(_ time.Time) error    { return errUnimplemented }
 func (*conn) SyscallConn() (syscall.RawConn, error) { return nil, errUnimplemented }
 
+func listenFDs(_ int) ([]activationFile, error)   { return nil, errUnimplemented }
+func fileConn(_ *os.File) (*Conn, error)          { return nil, errUnimplemented }
+func dupFile(_ *conn, _ string) (*os.File, error) { return nil, errUnimplemented }
+
+func connectTimeout(_ *conn) (time.Duration, error) { return 0, errUnimplemented }
+
+func bufferSize(_ *conn) (uint64, error)    { return 0, errUnimplemented }
+func setBufferSize(_ *conn, _ uint64) error { return errUnimplemented }
+
+func readBuffers(_ *conn, _ [][]byte) (int64, error)     { return 0, errUnimplemented }
+func writeBuffers(_ *conn, _ net.Buffers) (int64, error) { return 0, errUnimplemented }
+
+func queueDepths(_ *conn) (int, int, error) { return 0, 0, errUnimplemented }
+
+type zeroCopy struct{}
+
+func (*zeroCopy) setDeadline(_ time.Time) {}
+
+func writeZeroCopy(_ *conn, _ *zeroCopy, _ []byte) (int, error) { return 0, errUnimplemented }
+
+func readMsg(_ *conn, _ []byte) (int, MsgFlags, error) { return 0, 0, errUnimplemented }
+func writeMsg(_ *conn, _ []byte) (int, error)          { return 0, errUnimplemented }
+
+// readFrom and writeTo always fall back to a generic copy, which will then
+// fail with errUnimplemented.
+func readFrom(_ *conn, _ io.Reader) (int64, bool, error) { return 0, false, nil }
+func writeTo(_ *conn, _ io.Writer) (int64, bool, error)  { return 0, false, nil }
+
+func listenPacket(_, _ uint32, _ *Config) (*PacketConn, error) { return nil, errUnimplemented }
+
+type packetConn struct{}
+
+func (*packetConn) Close() error                           { return errUnimplemented }
+func (*packetConn) ReadFrom(_ []byte) (int, *Addr, error)  { return 0, nil, errUnimplemented }
+func (*packetConn) WriteTo(_ []byte, _ *Addr) (int, error) { return 0, errUnimplemented }
+func (*packetConn) SetDeadline(_ time.Time) error          { return errUnimplemented }
+func (*packetConn) SetReadDeadline(_ time.Time) error      { return errUnimplemented }
+func (*packetConn) SetWriteDeadline(_ time.Time) error     { return errUnimplemented }
+func (*packetConn) SyscallConn() (syscall.RawConn, error)  { return nil, errUnimplemented }
+
 func contextID() (uint32, error) { return 0, errUnimplemented }
 
 func isErrno(_ error, _ int) bool { return false }
+
+// errorSentinel never applies because errUnimplemented already matches
+// ErrUnsupported.
+func errorSentinel(_ string, _ error) error { return nil }
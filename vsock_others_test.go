@@ -3,7 +3,11 @@
 
 package vsock
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"testing"
+)
 
 func TestUnimplemented(t *testing.T) {
 	want := errUnimplemented
@@ -13,13 +17,17 @@ func TestUnimplemented(t *testing.T) {
 			want, got)
 	}
 
-	if _, got := listen(0, 0, nil); want != got {
+	if _, got := listen(context.Background(), 0, 0, &ListenConfig{}); want != got {
 		t.Fatalf("unexpected error from listen:\n- want: %v\n-  got: %v",
 			want, got)
 	}
 
-	if _, got := dial(0, 0, nil); want != got {
+	if _, got := dial(context.Background(), &Addr{}, &Dialer{}); want != got {
 		t.Fatalf("unexpected error from dial:\n- want: %v\n-  got: %v",
 			want, got)
 	}
+
+	if !errors.Is(want, ErrUnsupported) {
+		t.Fatalf("expected errUnimplemented to match ErrUnsupported: %v", want)
+	}
 }
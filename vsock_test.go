@@ -1,7 +1,15 @@
 package vsock
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestAddr_fileName(t *testing.T) {
@@ -46,3 +54,409 @@ func TestAddr_fileName(t *testing.T) {
 		})
 	}
 }
+
+func TestAddrString(t *testing.T) {
+	tests := []struct {
+		name string
+		a    *Addr
+		s    string
+	}{
+		{
+			name: "no flags",
+			a:    &Addr{ContextID: 3, Port: 1024},
+			s:    "vm(3):1024",
+		},
+		{
+			name: "to host",
+			a:    &Addr{ContextID: 4, Port: 1024, Flags: FlagToHost},
+			s:    "vm(4,to-host):1024",
+		},
+		{
+			name: "unknown flags",
+			a:    &Addr{ContextID: Host, Port: 1024, Flags: 0x80},
+			s:    "host(2,0x80):1024",
+		},
+		{
+			name: "to host and unknown flags",
+			a:    &Addr{ContextID: 5, Port: 1024, Flags: FlagToHost | 0x80},
+			s:    "vm(5,to-host|0x80):1024",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.s, tt.a.String()); diff != "" {
+				t.Fatalf("unexpected string (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want *Addr
+		err  string
+	}{
+		{
+			name: "numeric",
+			s:    "3:1024",
+			want: &Addr{ContextID: 3, Port: 1024},
+		},
+		{
+			name: "numeric host",
+			s:    "2:1024",
+			want: &Addr{ContextID: Host, Port: 1024},
+		},
+		{
+			name: "string VM",
+			s:    "vm(3):1024",
+			want: &Addr{ContextID: 3, Port: 1024},
+		},
+		{
+			name: "string hypervisor",
+			s:    "hypervisor(0):1",
+			want: &Addr{ContextID: Hypervisor, Port: 1},
+		},
+		{
+			name: "string local",
+			s:    "local(1):1024",
+			want: &Addr{ContextID: Local, Port: 1024},
+		},
+		{
+			name: "string host",
+			s:    "host(2):1024",
+			want: &Addr{ContextID: Host, Port: 1024},
+		},
+		{
+			name: "string any",
+			s:    "any(4294967295):1024",
+			want: &Addr{ContextID: cidAny, Port: 1024},
+		},
+		{
+			name: "string flags",
+			s:    "vm(4,to-host):1024",
+			want: &Addr{ContextID: 4, Port: 1024, Flags: FlagToHost},
+		},
+		{
+			name: "string unknown flags",
+			s:    "vm(4,to-host|0x80):1024",
+			want: &Addr{ContextID: 4, Port: 1024, Flags: FlagToHost | 0x80},
+		},
+		{
+			name: "symbolic hypervisor",
+			s:    "hypervisor:1024",
+			want: &Addr{ContextID: Hypervisor, Port: 1024},
+		},
+		{
+			name: "symbolic local",
+			s:    "local:1024",
+			want: &Addr{ContextID: Local, Port: 1024},
+		},
+		{
+			name: "symbolic host",
+			s:    "host:1024",
+			want: &Addr{ContextID: Host, Port: 1024},
+		},
+		{
+			name: "symbolic any",
+			s:    "any:1024",
+			want: &Addr{ContextID: cidAny, Port: 1024},
+		},
+		{
+			name: "URL numeric",
+			s:    "vsock://3:1024",
+			want: &Addr{ContextID: 3, Port: 1024},
+		},
+		{
+			name: "URL symbolic",
+			s:    "vsock://host:1024",
+			want: &Addr{ContextID: Host, Port: 1024},
+		},
+		{
+			name: "URL string",
+			s:    "vsock://vm(4,to-host):1024",
+			want: &Addr{ContextID: 4, Port: 1024, Flags: FlagToHost},
+		},
+		{
+			name: "empty",
+			err:  "missing port in address",
+		},
+		{
+			name: "no port",
+			s:    "3",
+			err:  "missing port in address",
+		},
+		{
+			name: "bad port",
+			s:    "3:foo",
+			err:  "invalid port",
+		},
+		{
+			name: "port too large",
+			s:    "3:4294967296",
+			err:  "invalid port",
+		},
+		{
+			name: "bad context ID",
+			s:    "foo:1024",
+			err:  "invalid context ID",
+		},
+		{
+			name: "context ID too large",
+			s:    "4294967296:1024",
+			err:  "invalid context ID",
+		},
+		{
+			name: "mismatched name",
+			s:    "host(3):1024",
+			err:  "invalid context ID",
+		},
+		{
+			name: "unterminated",
+			s:    "vm(3:1024",
+			err:  "invalid context ID",
+		},
+		{
+			name: "bad flags",
+			s:    "vm(3,foo):1024",
+			err:  "invalid flags",
+		},
+		{
+			name: "other scheme",
+			s:    "tcp://3:1024",
+			err:  "invalid context ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAddr(tt.s)
+			if tt.err != "" {
+				want := &net.AddrError{Err: tt.err, Addr: tt.s}
+				if diff := cmp.Diff(want, err); diff != "" {
+					t.Fatalf("unexpected error (-want +got):\n%s", diff)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse address: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected address (-want +got):\n%s", diff)
+			}
+
+			// The output of String must always parse to the same address.
+			rt, err := ParseAddr(got.String())
+			if err != nil {
+				t.Fatalf("failed to parse string address: %v", err)
+			}
+
+			if diff := cmp.Diff(got, rt); diff != "" {
+				t.Fatalf("unexpected round trip address (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddrText(t *testing.T) {
+	want := &Addr{ContextID: 4, Port: 1024, Flags: FlagToHost}
+
+	b, err := want.MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal text: %v", err)
+	}
+
+	var got Addr
+	if err := got.UnmarshalText(b); err != nil {
+		t.Fatalf("failed to unmarshal text: %v", err)
+	}
+
+	if diff := cmp.Diff(want, &got); diff != "" {
+		t.Fatalf("unexpected address (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddrFlagValue(t *testing.T) {
+	var addr Addr
+
+	fs := flag.NewFlagSet("vsock", flag.ContinueOnError)
+	fs.Var(&addr, "addr", "VM sockets address")
+
+	if err := fs.Parse([]string{"-addr", "host:1024"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	want := Addr{ContextID: Host, Port: 1024}
+	if diff := cmp.Diff(want, addr); diff != "" {
+		t.Fatalf("unexpected address (-want +got):\n%s", diff)
+	}
+
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse([]string{"-addr", "foo"}); err == nil {
+		t.Fatal("expected an error parsing invalid address, but none occurred")
+	}
+}
+
+func TestDialerDialAddrMissingAddress(t *testing.T) {
+	var d Dialer
+	_, err := d.DialAddr(context.Background(), nil)
+
+	nerr, ok := err.(*net.OpError)
+	if !ok || nerr.Op != opDial || nerr.Net != network {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+
+	if !errors.Is(err, errMissingAddress) {
+		t.Fatalf("expected missing address error, but got: %v", err)
+	}
+}
+
+func TestPacketConnWriteToInvalidAddr(t *testing.T) {
+	var (
+		local  = &Addr{ContextID: 3, Port: 1024}
+		remote = &net.UDPAddr{IP: net.IPv6loopback, Port: 1024}
+	)
+
+	// No socket is necessary because WriteTo must reject the address before
+	// performing any I/O.
+	c := &PacketConn{local: local}
+	_, got := c.WriteTo(nil, remote)
+
+	want := &net.OpError{
+		Op:     opWrite,
+		Net:    network,
+		Source: local,
+		Addr:   remote,
+		Err:    net.InvalidAddrError("address is not a *vsock.Addr"),
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+}
+
+func TestDialerDeadline(t *testing.T) {
+	var (
+		now   = time.Unix(1000, 0)
+		early = now.Add(1 * time.Second)
+		late  = now.Add(10 * time.Second)
+	)
+
+	tests := []struct {
+		name string
+		d    Dialer
+		ctx  time.Time
+		want time.Time
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "timeout",
+			d:    Dialer{Timeout: 1 * time.Second},
+			want: early,
+		},
+		{
+			name: "deadline",
+			d:    Dialer{Deadline: late},
+			want: late,
+		},
+		{
+			name: "context",
+			ctx:  late,
+			want: late,
+		},
+		{
+			name: "timeout before deadline",
+			d: Dialer{
+				Timeout:  1 * time.Second,
+				Deadline: late,
+			},
+			want: early,
+		},
+		{
+			name: "context before timeout",
+			d:    Dialer{Timeout: 10 * time.Second},
+			ctx:  early,
+			want: early,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if !tt.ctx.IsZero() {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, tt.ctx)
+				defer cancel()
+			}
+
+			if diff := cmp.Diff(tt.want, tt.d.deadline(ctx, now)); diff != "" {
+				t.Fatalf("unexpected deadline (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDialerDialContextErrors(t *testing.T) {
+	tests := []struct {
+		name             string
+		network, address string
+		want             error
+	}{
+		{
+			name:    "unknown network",
+			network: "udp",
+			address: "3:1024",
+			want:    net.UnknownNetworkError("udp"),
+		},
+		{
+			name:    "no port",
+			network: "vsock",
+			address: "3",
+			want:    &net.AddrError{Err: "missing port in address", Addr: "3"},
+		},
+		{
+			name:    "bad context ID",
+			network: "vsock",
+			address: "foo:1024",
+			want:    &net.AddrError{Err: "invalid context ID", Addr: "foo:1024"},
+		},
+		{
+			name:    "bad port",
+			network: "vsock",
+			address: "3:foo",
+			want:    &net.AddrError{Err: "invalid port", Addr: "3:foo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Dialer
+			c, err := d.DialContext(context.Background(), tt.network, tt.address)
+			if c != nil {
+				t.Fatalf("expected nil net.Conn, but got: %#v", c)
+			}
+
+			want := &net.OpError{
+				Op:  opDial,
+				Net: network,
+				Err: tt.want,
+			}
+
+			if diff := cmp.Diff(want, err); diff != "" {
+				t.Fatalf("unexpected error (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestErrUnsupported(t *testing.T) {
+	if !errors.Is(ErrUnsupported, errors.ErrUnsupported) {
+		t.Fatal("ErrUnsupported does not match errors.ErrUnsupported")
+	}
+}
@@ -0,0 +1,374 @@
+package vsocktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/vsock"
+	"golang.org/x/net/nettest"
+)
+
+// A halfCloser is a net.Conn which can shut down each direction of the
+// connection independently, like *vsock.Conn.
+type halfCloser interface {
+	net.Conn
+	CloseRead() error
+	CloseWrite() error
+}
+
+// RunConformance runs a suite of tests against tr to verify that it behaves
+// like the kernel VM sockets implementation of package vsock. The suite
+// includes nettest.TestConn, and verifies the addresses, half-close behavior,
+// and errors of tr's connections and listeners.
+//
+// Each test listens on vsock.Local with an ephemeral port and dials the
+// address reported by the listener's Addr method, so tr must be able to dial
+// its own listeners. Use RunConformancePair for Transports which cannot, such
+// as hybrid vsock. Connections must implement CloseRead and CloseWrite.
+func RunConformance(t *testing.T, tr vsock.Transport) {
+	runConformance(t, tr, tr, vsock.Local)
+}
+
+// RunConformancePair is like RunConformance, but connects two Transports,
+// such as those of a host and a guest. Each test listens using listen on its
+// own context ID with an ephemeral port, and dials the listener's address
+// using dial.
+//
+// A hybrid vsock Transport such as vsock.Hybrid may be used to dial a guest's
+// listeners, but not to listen, because hybrid vsock listeners cannot choose
+// an ephemeral port. The wildcard context ID and port reported by hybrid vsock
+// connections for unknown addresses, such as the guest's port, are accepted in
+// place of any other value.
+func RunConformancePair(t *testing.T, dial, listen vsock.Transport) {
+	cid, err := listen.ContextID()
+	if err != nil {
+		t.Fatalf("failed to get listen context ID: %v", err)
+	}
+
+	runConformance(t, dial, listen, cid)
+}
+
+// runConformance implements RunConformance and RunConformancePair, listening
+// on cid.
+func runConformance(t *testing.T, dial, listen vsock.Transport, cid uint32) {
+	tr := &pair{dial: dial, listen: listen, cid: cid}
+
+	t.Run("nettest", func(t *testing.T) {
+		nettest.TestConn(t, func() (c1, c2 net.Conn, stop func(), err error) {
+			return makePipe(tr)
+		})
+	})
+
+	t.Run("Addrs", func(t *testing.T) { testAddrs(t, tr) })
+	t.Run("CloseReadWrite", func(t *testing.T) { testCloseReadWrite(t, tr) })
+	t.Run("PeerClosedEOF", func(t *testing.T) { testPeerClosedEOF(t, tr) })
+	t.Run("ConnErrClosed", func(t *testing.T) { testConnErrClosed(t, tr) })
+	t.Run("ListenerErrClosed", func(t *testing.T) { testListenerErrClosed(t, tr) })
+	t.Run("DialConnectionRefused", func(t *testing.T) { testDialConnectionRefused(t, tr) })
+}
+
+// A pair is the Transports under test by RunConformance and
+// RunConformancePair.
+type pair struct {
+	dial, listen vsock.Transport
+
+	// cid is the context ID passed to listen.
+	cid uint32
+}
+
+// Dial dials addr using the dial Transport.
+func (p *pair) Dial(addr *vsock.Addr) (net.Conn, error) {
+	return p.dial.Dial(context.Background(), addr.ContextID, addr.Port)
+}
+
+// Listen listens on an ephemeral port using the listen Transport.
+func (p *pair) Listen() (net.Listener, error) {
+	return p.listen.Listen(context.Background(), p.cid, 0)
+}
+
+// testAddrs verifies that the addresses of a listener and both ends of a
+// connection are *vsock.Addr values which agree with each other.
+func testAddrs(t *testing.T, tr *pair) {
+	l := listen(t, tr)
+	laddr := l.Addr().(*vsock.Addr)
+
+	c1, err := tr.Dial(laddr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c1.Close()
+
+	c2, err := l.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer c2.Close()
+
+	for _, a := range []net.Addr{c1.LocalAddr(), c1.RemoteAddr(), c2.LocalAddr(), c2.RemoteAddr()} {
+		if _, ok := a.(*vsock.Addr); !ok {
+			t.Fatalf("expected *vsock.Addr, but got: %T", a)
+		}
+		if a.Network() != "vsock" {
+			t.Fatalf("unexpected address network: %q", a.Network())
+		}
+	}
+
+	checkAddr(t, "dialed remote", laddr, c1.RemoteAddr())
+	checkAddr(t, "accepted local", laddr, c2.LocalAddr())
+	checkAddr(t, "accepted remote", c1.LocalAddr(), c2.RemoteAddr())
+}
+
+// testCloseReadWrite verifies the behavior of CloseRead and CloseWrite.
+func testCloseReadWrite(t *testing.T, tr *pair) {
+	c1, c2 := pipe(t, tr)
+
+	// Data written before CloseWrite remains readable, followed by io.EOF.
+	if _, err := io.WriteString(c1, "hello"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := c1.CloseWrite(); err != nil {
+		t.Fatalf("failed to close write: %v", err)
+	}
+
+	b, err := io.ReadAll(c2)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(b)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+
+	// The other direction is unaffected until it is closed for reading.
+	if _, err := io.WriteString(c2, "world"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	b = make([]byte, 5)
+	if _, err := io.ReadFull(c1, b); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("world", string(b)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+
+	if err := c1.CloseRead(); err != nil {
+		t.Fatalf("failed to close read: %v", err)
+	}
+	if _, err := c1.Read(b); err != io.EOF {
+		t.Fatalf("expected read-closed read io.EOF, but got: %v", err)
+	}
+
+	// The kernel may or may not report a broken pipe to the writer once the
+	// reader has shut down, depending on timing, so only the shape of the
+	// error is checked.
+	if _, err := c2.Write(b); err != nil {
+		checkOpError(t, err, "write", c2.LocalAddr(), c2.RemoteAddr())
+	}
+}
+
+// testPeerClosedEOF verifies that reads return io.EOF itself, rather than an
+// error wrapping it, once the peer closes the connection.
+func testPeerClosedEOF(t *testing.T, tr *pair) {
+	c1, c2 := pipe(t, tr)
+
+	if _, err := io.WriteString(c1, "hello"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := c1.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c2, b); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, err := c2.Read(b); err != io.EOF {
+		t.Fatalf("expected peer closed read io.EOF, but got: %#v", err)
+	}
+}
+
+// testConnErrClosed verifies the errors returned by a closed connection.
+func testConnErrClosed(t *testing.T, tr *pair) {
+	c1, _ := pipe(t, tr)
+
+	if err := c1.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	_, err := c1.Read(make([]byte, 1))
+	checkOpError(t, err, "read", c1.LocalAddr(), c1.RemoteAddr())
+	if !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected read net.ErrClosed, but got: %v", err)
+	}
+
+	_, err = c1.Write(make([]byte, 1))
+	checkOpError(t, err, "write", c1.LocalAddr(), c1.RemoteAddr())
+	if !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected write net.ErrClosed, but got: %v", err)
+	}
+}
+
+// testListenerErrClosed verifies the error returned by a closed listener.
+func testListenerErrClosed(t *testing.T, tr *pair) {
+	l := listen(t, tr)
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	_, err := l.Accept()
+	checkOpError(t, err, "accept", nil, l.Addr())
+	if !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected accept net.ErrClosed, but got: %v", err)
+	}
+}
+
+// testDialConnectionRefused verifies the error returned when dialing an
+// address with no listener.
+func testDialConnectionRefused(t *testing.T, tr *pair) {
+	l := listen(t, tr)
+	laddr := l.Addr().(*vsock.Addr)
+
+	// Close the listener to free its address.
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	c, err := tr.Dial(laddr)
+	if err == nil {
+		_ = c.Close()
+		t.Fatal("expected an error, but dial succeeded")
+	}
+
+	checkOpError(t, err, "dial", nil, laddr)
+	if !errors.Is(err, vsock.ErrConnectionRefused) {
+		t.Fatalf("expected vsock.ErrConnectionRefused, but got: %v", err)
+	}
+}
+
+// checkOpError verifies that err is a *net.OpError for op with the specified
+// source and addr.
+func checkOpError(t *testing.T, err error, op string, source, addr net.Addr) {
+	t.Helper()
+
+	var oerr *net.OpError
+	if !errors.As(err, &oerr) {
+		t.Fatalf("expected *net.OpError, but got: %#v", err)
+	}
+
+	if oerr.Op != op || oerr.Net != "vsock" {
+		t.Fatalf("unexpected %s error op and network: %q, %q", op, oerr.Op, oerr.Net)
+	}
+
+	checkAddr(t, op+" error source", source, oerr.Source)
+	checkAddr(t, op+" error", addr, oerr.Addr)
+}
+
+// checkAddr verifies that got matches the address want, treating the wildcard
+// context ID and port in either address as matching any value.
+func checkAddr(t *testing.T, name string, want, got net.Addr) {
+	t.Helper()
+
+	if want == nil || got == nil {
+		if want != got {
+			t.Fatalf("unexpected %s address: want %v, got %v", name, want, got)
+		}
+		return
+	}
+
+	wa, wok := want.(*vsock.Addr)
+	ga, gok := got.(*vsock.Addr)
+	if !wok || !gok {
+		t.Fatalf("expected %s *vsock.Addr values, but got: %T and %T", name, want, got)
+	}
+
+	match := func(a, b uint32) bool { return a == b || a == cidAny || b == cidAny }
+	if !match(wa.ContextID, ga.ContextID) || !match(wa.Port, ga.Port) || wa.Flags != ga.Flags {
+		t.Fatalf("unexpected %s address (-want +got):\n%s", name, cmp.Diff(wa, ga))
+	}
+}
+
+// listen creates a listener using tr which is closed when the test completes.
+func listen(t *testing.T, tr *pair) net.Listener {
+	t.Helper()
+
+	l, err := tr.Listen()
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	if _, ok := l.Addr().(*vsock.Addr); !ok {
+		t.Fatalf("expected listener *vsock.Addr, but got: %T", l.Addr())
+	}
+
+	return l
+}
+
+// pipe creates a connected pair of connections using tr which are closed when
+// the test completes. The connections fail any operation which takes longer
+// than 10 seconds.
+func pipe(t *testing.T, tr *pair) (halfCloser, halfCloser) {
+	t.Helper()
+
+	c1, c2, stop, err := makePipe(tr)
+	if err != nil {
+		t.Fatalf("failed to make pipe: %v", err)
+	}
+	t.Cleanup(stop)
+
+	var hcs []halfCloser
+	for _, c := range []net.Conn{c1, c2} {
+		hc, ok := c.(halfCloser)
+		if !ok {
+			t.Fatalf("%T does not implement CloseRead and CloseWrite", c)
+		}
+
+		if err := hc.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			t.Fatalf("failed to set deadline: %v", err)
+		}
+
+		hcs = append(hcs, hc)
+	}
+
+	return hcs[0], hcs[1]
+}
+
+// makePipe creates a connected pair of connections by listening and dialing
+// the listener using tr.
+func makePipe(tr *pair) (c1, c2 net.Conn, stop func(), err error) {
+	l, err := tr.Listen()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer l.Close()
+
+	laddr, ok := l.Addr().(*vsock.Addr)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("expected listener *vsock.Addr, but got: %T", l.Addr())
+	}
+
+	c1, err = tr.Dial(laddr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	c2, err = l.Accept()
+	if err != nil {
+		_ = c1.Close()
+		return nil, nil, nil, err
+	}
+
+	stop = func() {
+		_ = c1.Close()
+		_ = c2.Close()
+	}
+
+	return c1, c2, stop, nil
+}
@@ -0,0 +1,417 @@
+package vsocktest
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/vsock"
+)
+
+var _ net.Conn = &Conn{}
+
+// A Conn is an in-memory VM sockets connection on a Network. Its methods
+// behave like those of vsock.Conn.
+type Conn struct {
+	n      *Network
+	m      *machine
+	local  *vsock.Addr
+	remote *vsock.Addr
+
+	// rx and tx are shared with the peer Conn, which reads from tx and writes
+	// to rx.
+	rx, tx *buffer
+
+	// bound reports whether local.Port must be released when the Conn is
+	// closed, as is the case for dialed Conns.
+	bound bool
+
+	rd, wd deadline
+
+	once sync.Once
+	done chan struct{}
+}
+
+// newConnPair creates a connected pair of Conns between laddr on machine m1
+// and raddr on machine m2, and registers them with their machines. n.mu must be
+// held.
+func newConnPair(n *Network, m1, m2 *machine, laddr, raddr *vsock.Addr) (*Conn, *Conn) {
+	b1, b2 := newBuffer(n.bufferSize), newBuffer(n.bufferSize)
+
+	c1 := &Conn{
+		n:      n,
+		m:      m1,
+		local:  laddr,
+		remote: raddr,
+		rx:     b1,
+		tx:     b2,
+		bound:  true,
+		rd:     makeDeadline(),
+		wd:     makeDeadline(),
+		done:   make(chan struct{}),
+	}
+
+	c2 := &Conn{
+		n:      n,
+		m:      m2,
+		local:  raddr,
+		remote: laddr,
+		rx:     b2,
+		tx:     b1,
+		rd:     makeDeadline(),
+		wd:     makeDeadline(),
+		done:   make(chan struct{}),
+	}
+
+	m1.conns[c1] = struct{}{}
+	m2.conns[c2] = struct{}{}
+
+	return c1, c2
+}
+
+// Close closes the connection. Any data which has not yet been read by the
+// peer remains readable, after which the peer's reads return io.EOF and its
+// writes fail.
+func (c *Conn) Close() error {
+	err := net.ErrClosed
+	c.once.Do(func() {
+		err = nil
+		close(c.done)
+
+		c.tx.shutdownWrite()
+		c.rx.shutdownRead()
+
+		c.n.mu.Lock()
+		defer c.n.mu.Unlock()
+
+		delete(c.m.conns, c)
+		if c.bound {
+			delete(c.m.ports, c.local.Port)
+		}
+	})
+
+	return c.opError(opClose, err)
+}
+
+// CloseRead shuts down the reading side of the connection. Most callers should
+// just use Close.
+func (c *Conn) CloseRead() error {
+	if c.isClosed() {
+		return c.opError(opClose, net.ErrClosed)
+	}
+
+	c.rx.shutdownRead()
+	return nil
+}
+
+// CloseWrite shuts down the writing side of the connection. Most callers should
+// just use Close.
+func (c *Conn) CloseWrite() error {
+	if c.isClosed() {
+		return c.opError(opClose, net.ErrClosed)
+	}
+
+	c.tx.shutdownWrite()
+	return nil
+}
+
+// LocalAddr returns the local network address. The Addr returned is shared by
+// all invocations of LocalAddr, so do not modify it.
+func (c *Conn) LocalAddr() net.Addr { return c.local }
+
+// RemoteAddr returns the remote network address. The Addr returned is shared by
+// all invocations of RemoteAddr, so do not modify it.
+func (c *Conn) RemoteAddr() net.Addr { return c.remote }
+
+// Read implements the net.Conn Read method.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.read(b)
+	if err == io.EOF {
+		// Like package vsock, io.EOF is returned directly.
+		return n, err
+	}
+
+	return n, c.opError(opRead, err)
+}
+
+// read implements Read.
+func (c *Conn) read(b []byte) (int, error) {
+	for {
+		if err := c.check(&c.rd); err != nil {
+			return 0, err
+		}
+
+		c.rx.mu.Lock()
+		switch {
+		case c.rx.reset:
+			c.rx.mu.Unlock()
+			return 0, os.NewSyscallError("read", syscall.ECONNRESET)
+		case c.rx.rshut:
+			c.rx.mu.Unlock()
+			return 0, io.EOF
+		case len(b) == 0:
+			c.rx.mu.Unlock()
+			return 0, nil
+		case len(c.rx.b) > 0:
+			n := copy(b, c.rx.b)
+			c.rx.b = c.rx.b[n:]
+			c.rx.notify()
+			c.rx.mu.Unlock()
+			return n, nil
+		case c.rx.wshut:
+			c.rx.mu.Unlock()
+			return 0, io.EOF
+		}
+
+		changed := c.rx.changed
+		c.rx.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-c.done:
+		case <-c.rd.wait():
+		}
+	}
+}
+
+// Write implements the net.Conn Write method.
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.write(b)
+	return n, c.opError(opWrite, err)
+}
+
+// write implements Write.
+func (c *Conn) write(b []byte) (int, error) {
+	var n int
+	for {
+		if err := c.check(&c.wd); err != nil {
+			return n, err
+		}
+
+		c.tx.mu.Lock()
+		switch {
+		case c.tx.reset:
+			c.tx.mu.Unlock()
+			return n, os.NewSyscallError("write", syscall.ECONNRESET)
+		case c.tx.wshut, c.tx.rshut:
+			c.tx.mu.Unlock()
+			return n, os.NewSyscallError("write", syscall.EPIPE)
+		case len(b) == 0:
+			c.tx.mu.Unlock()
+			return n, nil
+		case len(c.tx.b) < c.tx.size:
+			nn := min(c.tx.size-len(c.tx.b), len(b))
+			c.tx.b = append(c.tx.b, b[:nn]...)
+			c.tx.notify()
+			c.tx.mu.Unlock()
+
+			n += nn
+			b = b[nn:]
+			continue
+		}
+
+		changed := c.tx.changed
+		c.tx.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-c.done:
+		case <-c.wd.wait():
+		}
+	}
+}
+
+// SetDeadline implements the net.Conn SetDeadline method.
+func (c *Conn) SetDeadline(t time.Time) error {
+	if c.isClosed() {
+		return c.opError(opSet, net.ErrClosed)
+	}
+
+	c.rd.set(t)
+	c.wd.set(t)
+	return nil
+}
+
+// SetReadDeadline implements the net.Conn SetReadDeadline method.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	if c.isClosed() {
+		return c.opError(opSet, net.ErrClosed)
+	}
+
+	c.rd.set(t)
+	return nil
+}
+
+// SetWriteDeadline implements the net.Conn SetWriteDeadline method.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	if c.isClosed() {
+		return c.opError(opSet, net.ErrClosed)
+	}
+
+	c.wd.set(t)
+	return nil
+}
+
+// check returns an error if c is closed or the deadline d has passed.
+func (c *Conn) check(d *deadline) error {
+	select {
+	case <-c.done:
+		return net.ErrClosed
+	case <-d.wait():
+		return os.ErrDeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+// isClosed reports whether c is closed.
+func (c *Conn) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// reset resets the connection in both directions.
+func (c *Conn) reset() {
+	c.rx.setReset()
+	c.tx.setReset()
+}
+
+// opError is a convenience for the function opError that also passes the local
+// and remote addresses of the Conn.
+func (c *Conn) opError(op string, err error) error {
+	return opError(op, err, c.local, c.remote)
+}
+
+// A buffer is one direction of a connection.
+type buffer struct {
+	mu sync.Mutex
+
+	// changed is closed and replaced whenever the buffer's state changes.
+	changed chan struct{}
+
+	b    []byte
+	size int
+
+	// wshut reports that the writer will send no more data, and rshut
+	// reports that the reader will receive no more data.
+	wshut, rshut bool
+
+	// reset reports that the connection was reset.
+	reset bool
+}
+
+// newBuffer creates a buffer which holds up to size bytes.
+func newBuffer(size int) *buffer {
+	return &buffer{
+		changed: make(chan struct{}),
+		size:    size,
+	}
+}
+
+// notify wakes all waiters. b.mu must be held.
+func (b *buffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// shutdownRead discards any buffered data and marks the buffer as shut down by
+// its reader.
+func (b *buffer) shutdownRead() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.b = nil
+	b.rshut = true
+	b.notify()
+}
+
+// shutdownWrite marks the buffer as shut down by its writer.
+func (b *buffer) shutdownWrite() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.wshut = true
+	b.notify()
+}
+
+// setReset discards any buffered data and marks the buffer as reset.
+func (b *buffer) setReset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.b = nil
+	b.reset = true
+	b.notify()
+}
+
+// A deadline is a read, write, or accept deadline.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed once the deadline passes
+}
+
+// makeDeadline creates a deadline which never expires.
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+// set sets the deadline to t. The zero value for t clears the deadline.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// Wait for the timer to expire the deadline.
+		<-d.cancel
+	}
+	d.timer = nil
+
+	expired := isClosed(d.cancel)
+	if t.IsZero() {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	// The deadline is in the past.
+	if !expired {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel which is closed once the deadline passes.
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cancel
+}
+
+// isClosed reports whether c is closed.
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,185 @@
+package vsocktest
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/vsock"
+	"github.com/mdlayher/vsock/internal/vserr"
+)
+
+var _ net.Listener = &Listener{}
+
+// A Listener is an in-memory VM sockets listener on a Network. Its methods
+// behave like those of vsock.Listener.
+type Listener struct {
+	n    *Network
+	m    *machine
+	addr *vsock.Addr
+
+	d deadline
+
+	// mu guards the backlog of pending connections, and changed is closed and
+	// replaced whenever the backlog changes.
+	mu      sync.Mutex
+	changed chan struct{}
+	pending []*Conn
+	closed  bool
+
+	once sync.Once
+	done chan struct{}
+}
+
+// newListener creates a Listener bound to addr on machine m.
+func newListener(n *Network, m *machine, addr *vsock.Addr) *Listener {
+	return &Listener{
+		n:       n,
+		m:       m,
+		addr:    addr,
+		d:       makeDeadline(),
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Accept implements the Accept method in the net.Listener interface; it waits
+// for the next call and returns a generic net.Conn. The returned net.Conn will
+// always be of type *Conn.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.accept()
+	if err != nil {
+		return nil, l.opError(opAccept, err)
+	}
+
+	return c, nil
+}
+
+// accept implements Accept.
+func (l *Listener) accept() (*Conn, error) {
+	for {
+		select {
+		case <-l.done:
+			return nil, net.ErrClosed
+		case <-l.d.wait():
+			return nil, os.ErrDeadlineExceeded
+		default:
+		}
+
+		l.mu.Lock()
+		if len(l.pending) > 0 {
+			c := l.pending[0]
+			l.pending = l.pending[1:]
+			l.notify()
+			l.mu.Unlock()
+			return c, nil
+		}
+
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-l.done:
+		case <-l.d.wait():
+		}
+	}
+}
+
+// enqueue adds c to the backlog, waiting for room in the backlog until the
+// connect timeout expires or ctx is canceled.
+func (l *Listener) enqueue(ctx context.Context, c *Conn) error {
+	timer := time.NewTimer(l.n.connectTimeout)
+	defer timer.Stop()
+
+	for {
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return os.NewSyscallError("connect", syscall.ECONNRESET)
+		}
+		if len(l.pending) < l.n.backlog {
+			l.pending = append(l.pending, c)
+			l.notify()
+			l.mu.Unlock()
+			return nil
+		}
+
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return vserr.WithSentinel(
+				os.NewSyscallError("connect", syscall.ETIMEDOUT),
+				vsock.ErrConnectTimeout,
+			)
+		}
+	}
+}
+
+// notify wakes all waiters. l.mu must be held.
+func (l *Listener) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Addr returns the listener's network address. The returned net.Addr will
+// always be of type *vsock.Addr.
+func (l *Listener) Addr() net.Addr { return l.addr }
+
+// Close stops listening on the VM sockets address. Already Accepted
+// connections are not closed, but pending connections are reset.
+func (l *Listener) Close() error {
+	err := net.ErrClosed
+	l.once.Do(func() {
+		err = nil
+		close(l.done)
+
+		l.n.mu.Lock()
+		delete(l.m.listeners, l.addr.Port)
+		delete(l.m.ports, l.addr.Port)
+		l.n.mu.Unlock()
+
+		l.mu.Lock()
+		pending := l.pending
+		l.pending = nil
+		l.closed = true
+		l.notify()
+		l.mu.Unlock()
+
+		// Reset any connections which were not yet accepted.
+		for _, c := range pending {
+			c.reset()
+			_ = c.Close()
+		}
+	})
+
+	return l.opError(opClose, err)
+}
+
+// SetDeadline sets the deadline associated with the listener. A zero time value
+// disables the deadline.
+func (l *Listener) SetDeadline(t time.Time) error {
+	select {
+	case <-l.done:
+		return l.opError(opSet, net.ErrClosed)
+	default:
+	}
+
+	l.d.set(t)
+	return nil
+}
+
+// opError is a convenience for the function opError that also passes the local
+// address of the Listener.
+func (l *Listener) opError(op string, err error) error {
+	// No remote address for a Listener.
+	return opError(op, err, l.addr, nil)
+}
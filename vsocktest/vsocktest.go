@@ -0,0 +1,357 @@
+// Package vsocktest provides an in-memory VM sockets network for testing code
+// which uses package vsock, without the need for /dev/vsock or a hypervisor.
+//
+// A Network simulates any number of machines, each identified by a context ID.
+// The Transport for each machine implements vsock.Transport, and produces
+// connections and listeners which report *vsock.Addr addresses and return
+// errors shaped like those of package vsock, so they can be matched against
+// its sentinel errors such as vsock.ErrConnectionRefused.
+package vsocktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/vsock"
+	"github.com/mdlayher/vsock/internal/vserr"
+)
+
+const (
+	// Default values for Config fields, which match those of Linux.
+	defaultBacklog        = 128
+	defaultBufferSize     = 256 * 1024
+	defaultConnectTimeout = 2 * time.Second
+
+	// Ephemeral ports are assigned starting at the first port which is not
+	// reserved for privileged use.
+	firstEphemeralPort = 1024
+
+	// Wildcard values for context IDs and ports.
+	cidAny  = 0xffffffff
+	portAny = 0xffffffff
+)
+
+// Operation names which match those used by package vsock.
+const (
+	opAccept = vserr.OpAccept
+	opClose  = vserr.OpClose
+	opDial   = vserr.OpDial
+	opListen = vserr.OpListen
+	opRead   = vserr.OpRead
+	opSet    = vserr.OpSet
+	opWrite  = vserr.OpWrite
+)
+
+// Config contains options for a Network. The zero value for each field is
+// equivalent to the default behavior of Linux.
+type Config struct {
+	// Backlog specifies the maximum number of pending connections for each
+	// Listener. If zero, a default of 128 is used.
+	Backlog int
+
+	// BufferSize specifies the number of bytes which may be written to a
+	// connection before its peer reads them. If zero, a default of 256KiB is
+	// used.
+	BufferSize int
+
+	// ConnectTimeout specifies how long a dial waits for room in the backlog of
+	// a Listener before failing with an error which matches
+	// vsock.ErrConnectTimeout. If zero, a default of 2 seconds is used.
+	ConnectTimeout time.Duration
+}
+
+// A Network is an in-memory VM sockets network of simulated machines. Use
+// NewNetwork to create a Network.
+type Network struct {
+	backlog        int
+	bufferSize     int
+	connectTimeout time.Duration
+
+	mu       sync.Mutex
+	machines map[uint32]*machine
+}
+
+// A machine is the state of a single context ID on a Network.
+type machine struct {
+	cid       uint32
+	listeners map[uint32]*Listener
+	conns     map[*Conn]struct{}
+	ports     map[uint32]bool
+	nextPort  uint32
+}
+
+// NewNetwork creates an empty Network. If cfg is nil, a default configuration
+// will be used.
+func NewNetwork(cfg *Config) *Network {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	n := &Network{
+		backlog:        cfg.Backlog,
+		bufferSize:     cfg.BufferSize,
+		connectTimeout: cfg.ConnectTimeout,
+		machines:       make(map[uint32]*machine),
+	}
+
+	if n.backlog == 0 {
+		n.backlog = defaultBacklog
+	}
+	if n.bufferSize == 0 {
+		n.bufferSize = defaultBufferSize
+	}
+	if n.connectTimeout == 0 {
+		n.connectTimeout = defaultConnectTimeout
+	}
+
+	return n
+}
+
+// Transport returns the Transport for the machine with the specified context
+// ID, adding the machine to the Network if it does not already exist. Dialing a
+// context ID which has no Transport fails with an error which matches
+// vsock.ErrHostUnreachable.
+//
+// Transport panics if contextID is vsock.Local or the wildcard context ID,
+// which cannot identify a machine.
+func (n *Network) Transport(contextID uint32) *Transport {
+	if contextID == vsock.Local || contextID == cidAny {
+		panic(fmt.Sprintf("vsocktest: invalid context ID %d for Transport", contextID))
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.machines[contextID]; !ok {
+		n.machines[contextID] = &machine{
+			cid:       contextID,
+			listeners: make(map[uint32]*Listener),
+			conns:     make(map[*Conn]struct{}),
+			ports:     make(map[uint32]bool),
+			nextPort:  firstEphemeralPort,
+		}
+	}
+
+	return &Transport{
+		n:   n,
+		cid: contextID,
+	}
+}
+
+// Reset simulates a reset of the VM sockets transport of the machine with the
+// specified context ID, as happens when a virtual machine is live migrated or
+// restored from a snapshot. All established connections to and from the
+// machine fail with errors which match vsock.ErrTransportReset. Listeners are
+// not affected.
+func (n *Network) Reset(contextID uint32) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	m, ok := n.machines[contextID]
+	if !ok {
+		return
+	}
+
+	for c := range m.conns {
+		c.reset()
+	}
+}
+
+// bind reserves port on m, or an ephemeral port if port is zero or the
+// wildcard port. n.mu must be held.
+func (m *machine) bind(port uint32) (uint32, error) {
+	if port != 0 && port != portAny {
+		if m.ports[port] {
+			return 0, syscall.EADDRINUSE
+		}
+
+		m.ports[port] = true
+		return port, nil
+	}
+
+	for i := 0; i < len(m.ports)+1; i++ {
+		port := m.nextPort
+		m.nextPort++
+		if m.nextPort == portAny {
+			m.nextPort = firstEphemeralPort
+		}
+
+		if !m.ports[port] {
+			m.ports[port] = true
+			return port, nil
+		}
+	}
+
+	return 0, syscall.EADDRNOTAVAIL
+}
+
+var _ vsock.Transport = &Transport{}
+
+// A Transport is a vsock.Transport for a single machine on a Network. Use
+// Network.Transport to create a Transport.
+type Transport struct {
+	n   *Network
+	cid uint32
+}
+
+// ContextID implements vsock.Transport, returning the context ID of this
+// Transport's machine.
+func (t *Transport) ContextID() (uint32, error) { return t.cid, nil }
+
+// Dial implements vsock.Transport. Dialing vsock.Local or the Transport's own
+// context ID connects to a Listener on the same machine. The returned net.Conn
+// will always be of type *Conn.
+//
+// If no machine exists at contextID, the error matches
+// vsock.ErrHostUnreachable. If no Listener exists at port, the error matches
+// vsock.ErrConnectionRefused. If the Listener's backlog remains full for the
+// Network's connect timeout, the error matches vsock.ErrConnectTimeout.
+func (t *Transport) Dial(ctx context.Context, contextID, port uint32) (net.Conn, error) {
+	raddr := &vsock.Addr{ContextID: contextID, Port: port}
+
+	c, err := t.dial(ctx, raddr)
+	if err != nil {
+		// No local address, but we have a remote address we can return.
+		return nil, opError(opDial, err, nil, raddr)
+	}
+
+	return c, nil
+}
+
+// dial implements Dial.
+func (t *Transport) dial(ctx context.Context, raddr *vsock.Addr) (*Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c1, c2, l, err := t.connect(raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.enqueue(ctx, c2); err != nil {
+		_ = c1.Close()
+		_ = c2.Close()
+		return nil, err
+	}
+
+	return c1, nil
+}
+
+// connect creates a connected pair of Conns for a dial to raddr, and returns
+// the Listener which must accept the second Conn.
+func (t *Transport) connect(raddr *vsock.Addr) (*Conn, *Conn, *Listener, error) {
+	t.n.mu.Lock()
+	defer t.n.mu.Unlock()
+
+	local := t.n.machines[t.cid]
+
+	// Dialing Local or this machine's context ID uses loopback.
+	lcid, remote := t.cid, local
+	if raddr.ContextID == vsock.Local {
+		lcid = vsock.Local
+	} else if raddr.ContextID != t.cid {
+		m, ok := t.n.machines[raddr.ContextID]
+		if !ok {
+			return nil, nil, nil, os.NewSyscallError("connect", syscall.EHOSTUNREACH)
+		}
+		remote = m
+	}
+
+	// A Listener bound to a specific context ID only accepts connections to
+	// that context ID.
+	l, ok := remote.listeners[raddr.Port]
+	if !ok || (l.addr.ContextID != cidAny && l.addr.ContextID != raddr.ContextID) {
+		return nil, nil, nil, os.NewSyscallError("connect", syscall.ECONNREFUSED)
+	}
+
+	lport, err := local.bind(0)
+	if err != nil {
+		return nil, nil, nil, os.NewSyscallError("bind", err)
+	}
+
+	laddr := &vsock.Addr{ContextID: lcid, Port: lport}
+	c1, c2 := newConnPair(t.n, local, remote, laddr, &vsock.Addr{
+		ContextID: raddr.ContextID,
+		Port:      raddr.Port,
+	})
+
+	return c1, c2, l, nil
+}
+
+// Listen implements vsock.Transport. The context ID must be vsock.Local, the
+// Transport's own context ID, or the wildcard context ID used by
+// vsock.ListenAny. A port of zero chooses an ephemeral port. The returned
+// net.Listener will always be of type *Listener.
+func (t *Transport) Listen(ctx context.Context, contextID, port uint32) (net.Listener, error) {
+	l, err := t.listen(ctx, contextID, port)
+	if err != nil {
+		// No remote address available.
+		return nil, opError(opListen, err, &vsock.Addr{
+			ContextID: contextID,
+			Port:      port,
+		}, nil)
+	}
+
+	return l, nil
+}
+
+// listen implements Listen.
+func (t *Transport) listen(ctx context.Context, contextID, port uint32) (*Listener, error) {
+	// Creating a Listener does not block, so the context is only checked for
+	// cancelation before any changes are made.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if contextID != t.cid && contextID != vsock.Local && contextID != cidAny {
+		return nil, os.NewSyscallError("bind", syscall.EADDRNOTAVAIL)
+	}
+
+	t.n.mu.Lock()
+	defer t.n.mu.Unlock()
+
+	m := t.n.machines[t.cid]
+	port, err := m.bind(port)
+	if err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	l := newListener(t.n, m, &vsock.Addr{ContextID: contextID, Port: port})
+	m.listeners[port] = l
+	return l, nil
+}
+
+// opError produces a net.OpError using the same rules as package vsock. As a
+// convenience, opError returns nil if the input error is nil.
+func opError(op string, err error, local, remote net.Addr) error {
+	if err == nil {
+		return nil
+	}
+
+	return vserr.OpError(op, withSentinel(op, err), local, remote)
+}
+
+// withSentinel wraps err with the package vsock sentinel error which classifies
+// it, if any.
+func withSentinel(op string, err error) error {
+	var sentinel error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED),
+		// A Listener which closes while a dial is pending resets it.
+		op == opDial && errors.Is(err, syscall.ECONNRESET):
+		sentinel = vsock.ErrConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		sentinel = vsock.ErrTransportReset
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		sentinel = vsock.ErrHostUnreachable
+	}
+
+	return vserr.WithSentinel(err, sentinel)
+}
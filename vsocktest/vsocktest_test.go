@@ -0,0 +1,339 @@
+package vsocktest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/vsock"
+	"github.com/mdlayher/vsock/vsocktest"
+)
+
+const guestCID = 3
+
+func TestRunConformance(t *testing.T) {
+	n := vsocktest.NewNetwork(nil)
+	vsocktest.RunConformance(t, n.Transport(vsock.Host))
+}
+
+func TestRunConformancePair(t *testing.T) {
+	n := vsocktest.NewNetwork(nil)
+	host, guest := n.Transport(vsock.Host), n.Transport(guestCID)
+
+	t.Run("guest to host", func(t *testing.T) {
+		vsocktest.RunConformancePair(t, guest, host)
+	})
+	t.Run("host to guest", func(t *testing.T) {
+		vsocktest.RunConformancePair(t, host, guest)
+	})
+}
+
+func TestConnAddrs(t *testing.T) {
+	n := vsocktest.NewNetwork(nil)
+	host, guest := n.Transport(vsock.Host), n.Transport(guestCID)
+
+	// Listen on the wildcard context ID, as vsock.ListenAny does.
+	l, err := host.Listen(context.Background(), 0xffffffff, 1024)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	c1, err := guest.Dial(context.Background(), vsock.Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c1.Close()
+
+	c2, err := l.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer c2.Close()
+
+	var (
+		haddr = &vsock.Addr{ContextID: vsock.Host, Port: 1024}
+		gaddr = &vsock.Addr{ContextID: guestCID, Port: 1024}
+	)
+
+	if diff := cmp.Diff(haddr, c1.RemoteAddr()); diff != "" {
+		t.Fatalf("unexpected dialed remote address (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(gaddr, c1.LocalAddr()); diff != "" {
+		t.Fatalf("unexpected dialed local address (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(haddr, c2.LocalAddr()); diff != "" {
+		t.Fatalf("unexpected accepted local address (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(gaddr, c2.RemoteAddr()); diff != "" {
+		t.Fatalf("unexpected accepted remote address (-want +got):\n%s", diff)
+	}
+}
+
+func TestDialErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *vsocktest.Config
+		cid      uint32
+		port     uint32
+		sentinel error
+		errno    syscall.Errno
+	}{
+		{
+			name:     "unknown context ID",
+			cid:      4,
+			port:     1024,
+			sentinel: vsock.ErrHostUnreachable,
+			errno:    syscall.EHOSTUNREACH,
+		},
+		{
+			name:     "no listener",
+			cid:      vsock.Host,
+			port:     1025,
+			sentinel: vsock.ErrConnectionRefused,
+			errno:    syscall.ECONNREFUSED,
+		},
+		{
+			name:     "listener context ID mismatch",
+			cid:      vsock.Local,
+			port:     1024,
+			sentinel: vsock.ErrConnectionRefused,
+			errno:    syscall.ECONNREFUSED,
+		},
+		{
+			name: "backlog full",
+			cfg: &vsocktest.Config{
+				Backlog:        1,
+				ConnectTimeout: 50 * time.Millisecond,
+			},
+			cid:      vsock.Host,
+			port:     1024,
+			sentinel: vsock.ErrConnectTimeout,
+			errno:    syscall.ETIMEDOUT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := vsocktest.NewNetwork(tt.cfg)
+			host, guest := n.Transport(vsock.Host), n.Transport(guestCID)
+
+			l, err := host.Listen(context.Background(), vsock.Host, 1024)
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer l.Close()
+
+			if tt.cfg != nil {
+				// Fill the backlog.
+				c, err := guest.Dial(context.Background(), vsock.Host, 1024)
+				if err != nil {
+					t.Fatalf("failed to dial: %v", err)
+				}
+				defer c.Close()
+			}
+
+			_, err = guest.Dial(context.Background(), tt.cid, tt.port)
+
+			var oerr *net.OpError
+			if !errors.As(err, &oerr) {
+				t.Fatalf("expected *net.OpError, but got: %#v", err)
+			}
+			if oerr.Op != "dial" {
+				t.Fatalf("unexpected op: %q", oerr.Op)
+			}
+
+			if diff := cmp.Diff(&vsock.Addr{ContextID: tt.cid, Port: tt.port}, oerr.Addr); diff != "" {
+				t.Fatalf("unexpected error address (-want +got):\n%s", diff)
+			}
+			if !errors.Is(err, tt.sentinel) || !errors.Is(err, tt.errno) {
+				t.Fatalf("expected %v and %v, but got: %v", tt.sentinel, tt.errno, err)
+			}
+		})
+	}
+}
+
+func TestDialContextCanceled(t *testing.T) {
+	n := vsocktest.NewNetwork(&vsocktest.Config{Backlog: 1})
+	host, guest := n.Transport(vsock.Host), n.Transport(guestCID)
+
+	l, err := host.Listen(context.Background(), vsock.Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	// Fill the backlog so that the next dial blocks until the context expires.
+	c, err := guest.Dial(context.Background(), vsock.Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := guest.Dial(ctx, vsock.Host, 1024); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded, but got: %v", err)
+	}
+}
+
+func TestListenErrors(t *testing.T) {
+	n := vsocktest.NewNetwork(nil)
+	host := n.Transport(vsock.Host)
+
+	l, err := host.Listen(context.Background(), vsock.Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	if _, err := host.Listen(context.Background(), vsock.Local, 1024); !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("expected address in use, but got: %v", err)
+	}
+	if _, err := host.Listen(context.Background(), guestCID, 1025); !errors.Is(err, syscall.EADDRNOTAVAIL) {
+		t.Fatalf("expected address not available, but got: %v", err)
+	}
+
+	// The port is released once the Listener is closed.
+	if err := l.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	l, err = host.Listen(context.Background(), vsock.Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to listen again: %v", err)
+	}
+	_ = l.Close()
+
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, but got: %v", err)
+	}
+}
+
+func TestConnHalfClose(t *testing.T) {
+	n := vsocktest.NewNetwork(nil)
+	c1, c2, stop, err := makePipe(n.Transport(vsock.Host), n.Transport(guestCID), vsock.Host)
+	if err != nil {
+		t.Fatalf("failed to make pipe: %v", err)
+	}
+	defer stop()
+
+	vc1, vc2 := c1.(*vsocktest.Conn), c2.(*vsocktest.Conn)
+
+	if _, err := io.WriteString(vc1, "hello"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := vc1.CloseWrite(); err != nil {
+		t.Fatalf("failed to close write: %v", err)
+	}
+
+	// Buffered data is read before io.EOF.
+	b, err := io.ReadAll(vc2)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(b)); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+
+	if _, err := vc1.Write([]byte{0}); !errors.Is(err, syscall.EPIPE) {
+		t.Fatalf("expected write-closed write broken pipe, but got: %v", err)
+	}
+
+	// The other direction still works until vc1 closes it for reading.
+	if _, err := io.WriteString(vc2, "world"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := vc1.CloseRead(); err != nil {
+		t.Fatalf("failed to close read: %v", err)
+	}
+	if _, err := vc1.Read(make([]byte, 8)); err != io.EOF {
+		t.Fatalf("expected read-closed read EOF, but got: %v", err)
+	}
+	if _, err := vc2.Write([]byte{0}); !errors.Is(err, syscall.EPIPE) {
+		t.Fatalf("expected peer read-closed write broken pipe, but got: %v", err)
+	}
+}
+
+func TestNetworkReset(t *testing.T) {
+	n := vsocktest.NewNetwork(nil)
+	host, guest := n.Transport(vsock.Host), n.Transport(guestCID)
+
+	l, err := host.Listen(context.Background(), vsock.Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	c1, err := guest.Dial(context.Background(), vsock.Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c1.Close()
+
+	c2, err := l.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer c2.Close()
+
+	// Block in Read until the reset occurs.
+	errC := make(chan error, 1)
+	go func() {
+		_, err := c2.Read(make([]byte, 8))
+		errC <- err
+	}()
+
+	n.Reset(guestCID)
+
+	for _, err := range []error{
+		<-errC,
+		func() error { _, err := c1.Write([]byte{0}); return err }(),
+	} {
+		if !errors.Is(err, vsock.ErrTransportReset) || !errors.Is(err, syscall.ECONNRESET) {
+			t.Fatalf("expected transport reset, but got: %v", err)
+		}
+	}
+
+	// The Listener is unaffected.
+	c3, err := guest.Dial(context.Background(), vsock.Host, 1024)
+	if err != nil {
+		t.Fatalf("failed to dial after reset: %v", err)
+	}
+	_ = c3.Close()
+}
+
+// makePipe creates a connected pair of net.Conns by listening on cid with
+// listen and dialing it with dial.
+func makePipe(listen, dial *vsocktest.Transport, cid uint32) (c1, c2 net.Conn, stop func(), err error) {
+	l, err := listen.Listen(context.Background(), cid, 0)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer l.Close()
+
+	addr := l.Addr().(*vsock.Addr)
+	c1, err = dial.Dial(context.Background(), addr.ContextID, addr.Port)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	c2, err = l.Accept()
+	if err != nil {
+		_ = c1.Close()
+		return nil, nil, nil, err
+	}
+
+	stop = func() {
+		_ = c1.Close()
+		_ = c2.Close()
+	}
+
+	return c1, c2, stop, nil
+}
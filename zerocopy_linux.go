@@ -0,0 +1,241 @@
+//go:build linux
+
+package vsock
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// vsockRecvErr is VSOCK_RECVERR from <linux/vm_sockets.h>, the control
+	// message type for VM sockets error queue messages.
+	vsockRecvErr = 1
+
+	// sizeofSockExtendedErr is the size of a struct sock_extended_err.
+	sizeofSockExtendedErr = 16
+)
+
+// A zeroCopy tracks the MSG_ZEROCOPY completion notifications for a Conn.
+type zeroCopy struct {
+	mu sync.Mutex
+
+	// next is the sequence number of the next zerocopy send and done is one
+	// past the sequence number of the last completed send. All sends are
+	// complete when done has caught up with next; see pending.
+	next, done uint32
+
+	// unsupported is set when the transport rejects MSG_ZEROCOPY, in which
+	// case all further writes copy data.
+	unsupported bool
+
+	// deadline is the write deadline of the Conn in Unix nanoseconds, or zero
+	// for no deadline, which also applies to waiting for completions.
+	deadline atomic.Int64
+}
+
+// setDeadline sets the deadline for waiting for completions. A zero time value
+// disables the deadline.
+func (zc *zeroCopy) setDeadline(t time.Time) {
+	if t.IsZero() {
+		zc.deadline.Store(0)
+		return
+	}
+
+	zc.deadline.Store(t.UnixNano())
+}
+
+// pending reports whether any zerocopy sends are not yet complete. The
+// comparison handles wraparound of the sequence numbers, and tolerates the
+// kernel using more sequence numbers than expected, in which case done may
+// pass next.
+func (zc *zeroCopy) pending() bool { return int32(zc.next-zc.done) > 0 }
+
+// enableZeroCopy sets SO_ZEROCOPY on c. If the kernel or transport does not
+// support zerocopy, it returns nil and no error so Conn.WriteZeroCopy falls
+// back to copying.
+func enableZeroCopy(c *conn) (*zeroCopy, error) {
+	var serr error
+	err := control(c, func(fd int) {
+		serr = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ZEROCOPY, 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case serr == nil:
+		return &zeroCopy{}, nil
+	case errors.Is(serr, unix.EOPNOTSUPP), errors.Is(serr, unix.ENOPROTOOPT), errors.Is(serr, unix.EINVAL):
+		return nil, nil
+	default:
+		return nil, os.NewSyscallError("setsockopt", serr)
+	}
+}
+
+// writeZeroCopy is the entry point for Conn.WriteZeroCopy on Linux.
+func writeZeroCopy(c *conn, zc *zeroCopy, b []byte) (int, error) {
+	if zc == nil {
+		return c.Write(b)
+	}
+
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+
+	if zc.unsupported {
+		return c.Write(b)
+	}
+
+	var n int
+	for n < len(b) {
+		nn, err := c.Sendmsg(context.Background(), b[n:], nil, nil, unix.MSG_ZEROCOPY)
+		if nn > 0 {
+			// The kernel assigns a sequence number to each sendmsg(2) call
+			// which sends data, even if it only sent part of the buffer.
+			n += nn
+			zc.next++
+		}
+
+		switch {
+		case errors.Is(err, unix.ENOBUFS) && zc.pending():
+			// The kernel has pinned as many pages as it allows for this
+			// socket. Wait for outstanding sends to complete and try again.
+			if err := zc.wait(c); err != nil {
+				return n, err
+			}
+			continue
+		case errors.Is(err, unix.ENOBUFS), errors.Is(err, unix.EOPNOTSUPP):
+			// Zerocopy is not possible for this transport or message, so copy
+			// the remaining data instead.
+			if errors.Is(err, unix.EOPNOTSUPP) {
+				zc.unsupported = true
+			}
+
+			nn, err := c.Write(b[n:])
+			n += nn
+			if err != nil {
+				_ = zc.wait(c)
+				return n, err
+			}
+
+			return n, zc.wait(c)
+		case err != nil:
+			// The caller's buffer must not be reused until the kernel is done
+			// with any data which was already sent.
+			_ = zc.wait(c)
+			return n, err
+		}
+	}
+
+	return n, zc.wait(c)
+}
+
+// zeroCopyPollTimeout bounds each poll(2) for completion notifications, so that
+// a waiter periodically releases the socket and does not delay Close.
+const zeroCopyPollTimeout = 50 // milliseconds
+
+// wait blocks until the kernel reports that all zerocopy sends are complete,
+// or until the write deadline of the Conn expires.
+func (zc *zeroCopy) wait(c *conn) error {
+	oob := make([]byte, unix.CmsgSpace(sizeofSockExtendedErr))
+	for zc.pending() {
+		timeout := zeroCopyPollTimeout
+		if d := zc.deadline.Load(); d != 0 {
+			remain := time.Until(time.Unix(0, d))
+			if remain <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+
+			// Round up so the final poll does not end just before the
+			// deadline.
+			timeout = min(timeout, int((remain+time.Millisecond-1)/time.Millisecond))
+		}
+
+		var werr error
+		err := control(c, func(fd int) {
+			if werr = zc.drain(fd, oob); werr != nil || !zc.pending() {
+				return
+			}
+
+			// The error queue is not tied to the read or write side of the
+			// socket, so poll it directly rather than holding either lock.
+			// poll(2) always reports POLLERR while the error queue is not
+			// empty, so no notification is missed between drain and poll.
+			fds := []unix.PollFd{{Fd: int32(fd)}}
+			_, err := unix.Poll(fds, timeout)
+			switch {
+			case errors.Is(err, unix.EINTR):
+			case err != nil:
+				werr = os.NewSyscallError("poll", err)
+			case fds[0].Revents&unix.POLLERR == 0 && fds[0].Revents != 0:
+				// The peer hung up, which poll(2) continues to report
+				// immediately. Avoid spinning until the kernel releases the
+				// remaining sends.
+				time.Sleep(time.Millisecond)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if werr != nil {
+			return werr
+		}
+	}
+
+	return nil
+}
+
+// drain processes the completion notifications on the error queue of fd
+// without blocking, until the queue is empty or all sends are complete.
+func (zc *zeroCopy) drain(fd int, oob []byte) error {
+	for zc.pending() {
+		_, oobn, _, _, err := unix.Recvmsg(fd, nil, oob, unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+		switch {
+		case errors.Is(err, unix.EINTR):
+			continue
+		case errors.Is(err, unix.EAGAIN):
+			return nil
+		case err != nil:
+			return os.NewSyscallError("recvmsg", err)
+		}
+
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return os.NewSyscallError("recvmsg", err)
+		}
+
+		zc.complete(msgs)
+	}
+
+	return nil
+}
+
+// complete processes the MSG_ZEROCOPY completion notifications in msgs.
+func (zc *zeroCopy) complete(msgs []unix.SocketControlMessage) {
+	for _, m := range msgs {
+		if m.Header.Level != unix.SOL_VSOCK || m.Header.Type != vsockRecvErr ||
+			len(m.Data) < sizeofSockExtendedErr {
+			continue
+		}
+
+		// Decode the relevant fields of struct sock_extended_err. The kernel
+		// may also report that it copied the data anyway by setting
+		// SO_EE_CODE_ZEROCOPY_COPIED in ee_code, but either way the send is
+		// complete.
+		origin := m.Data[4]
+		if origin != unix.SO_EE_ORIGIN_ZEROCOPY {
+			continue
+		}
+
+		// The notification covers the inclusive range of sequence numbers
+		// [ee_info, ee_data] and ranges are reported in order.
+		zc.done = binary.NativeEndian.Uint32(m.Data[12:16]) + 1
+	}
+}
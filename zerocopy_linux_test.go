@@ -0,0 +1,172 @@
+package vsock
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sys/unix"
+)
+
+func Test_zeroCopyComplete(t *testing.T) {
+	// extendedErr produces the data for a struct sock_extended_err.
+	extendedErr := func(origin uint8, lo, hi uint32) []byte {
+		b := make([]byte, sizeofSockExtendedErr)
+		b[4] = origin
+		binary.NativeEndian.PutUint32(b[8:12], lo)
+		binary.NativeEndian.PutUint32(b[12:16], hi)
+		return b
+	}
+
+	msg := func(level, typ int32, data []byte) unix.SocketControlMessage {
+		return unix.SocketControlMessage{
+			Header: unix.Cmsghdr{Level: level, Type: typ},
+			Data:   data,
+		}
+	}
+
+	zc := &zeroCopy{next: 4}
+	zc.complete([]unix.SocketControlMessage{
+		// Sends 0 through 2 are complete.
+		msg(unix.SOL_VSOCK, vsockRecvErr, extendedErr(unix.SO_EE_ORIGIN_ZEROCOPY, 0, 2)),
+		// Not a zerocopy notification.
+		msg(unix.SOL_VSOCK, vsockRecvErr, extendedErr(unix.SO_EE_ORIGIN_LOCAL, 0, 10)),
+		// Not a VM sockets error queue message.
+		msg(unix.SOL_IP, unix.IP_RECVERR, extendedErr(unix.SO_EE_ORIGIN_ZEROCOPY, 0, 10)),
+		// Truncated.
+		msg(unix.SOL_VSOCK, vsockRecvErr, []byte{0}),
+	})
+
+	if diff := cmp.Diff(uint32(3), zc.done); diff != "" {
+		t.Fatalf("unexpected completed sends (-want +got):\n%s", diff)
+	}
+
+	// Send 3 completes the outstanding sends.
+	zc.complete([]unix.SocketControlMessage{
+		msg(unix.SOL_VSOCK, vsockRecvErr, extendedErr(unix.SO_EE_ORIGIN_ZEROCOPY, 3, 3)),
+	})
+
+	if zc.next != zc.done {
+		t.Fatalf("expected all sends to be complete, but got next: %d, done: %d", zc.next, zc.done)
+	}
+}
+
+func Test_zeroCopyUnsupported(t *testing.T) {
+	// UNIX sockets don't support SO_ZEROCOPY, which must not be treated as an
+	// error.
+	c, peer := socketPair(t)
+
+	zc, err := enableZeroCopy(c)
+	if err != nil {
+		t.Fatalf("failed to enable zerocopy: %v", err)
+	}
+	if zc != nil {
+		t.Fatal("expected zerocopy to be unsupported")
+	}
+
+	// Writes fall back to copying.
+	want := []byte("hello world")
+	if _, err := writeZeroCopy(c, zc, want); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(peer, got); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected data (-want +got):\n%s", diff)
+	}
+}
+
+func Test_zeroCopyWaitClose(t *testing.T) {
+	// No completions arrive on UNIX sockets, so wait blocks until the
+	// connection is closed. It must not hold the socket in a way which
+	// prevents Close or concurrent writes.
+	c, peer := socketPair(t)
+
+	zc := &zeroCopy{next: 1}
+	errC := make(chan error, 1)
+	go func() { errC <- zc.wait(c) }()
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write while waiting: %v", err)
+	}
+	if _, err := io.ReadFull(peer, make([]byte, 5)); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	select {
+	case err := <-errC:
+		if err == nil {
+			t.Fatal("expected an error after close, but none occurred")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for wait to return")
+	}
+}
+
+func Test_zeroCopyWaitDeadline(t *testing.T) {
+	// No completions arrive on UNIX sockets, so only the write deadline can
+	// end the wait.
+	sc, _ := socketPair(t)
+
+	zc := &zeroCopy{next: 1}
+	c := &Conn{c: sc, zc: zc}
+	if err := c.SetWriteDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set write deadline: %v", err)
+	}
+
+	errC := make(chan error, 1)
+	go func() { errC <- zc.wait(sc) }()
+
+	select {
+	case err := <-errC:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, but got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for wait to return")
+	}
+}
+
+func Test_zeroCopyPending(t *testing.T) {
+	tests := []struct {
+		name       string
+		next, done uint32
+		pending    bool
+	}{
+		{name: "complete", next: 3, done: 3},
+		{name: "outstanding", next: 3, done: 1, pending: true},
+		// The kernel used more sequence numbers than expected.
+		{name: "done past next", next: 3, done: 5},
+		{name: "wraparound", next: 1, done: math.MaxUint32, pending: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zc := &zeroCopy{next: tt.next, done: tt.done}
+			if diff := cmp.Diff(tt.pending, zc.pending()); diff != "" {
+				t.Fatalf("unexpected pending (-want +got):\n%s", diff)
+			}
+
+			if !tt.pending {
+				// wait must return immediately rather than spin.
+				sc, _ := socketPair(t)
+				if err := zc.wait(sc); err != nil {
+					t.Fatalf("failed to wait: %v", err)
+				}
+			}
+		})
+	}
+}